@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/boltdb/bolt"
+	"github.com/eljuanchosf/gocafier/i18n"
 	log "github.com/eljuanchosf/gocafier/logging"
 	"github.com/kr/pretty"
 	"github.com/mitchellh/go-homedir"
@@ -15,7 +16,6 @@ const (
 	bucketName = "packages"
 )
 
-var appdb *bolt.DB
 var open bool
 
 //DetailLog represents a log of package movements
@@ -66,20 +66,22 @@ func createDatabase(cacheFilename string) error {
 		cacheFilename += "/.gocafier.db"
 	}
 
-	log.LogStd(fmt.Sprintf("Setting cache file to %s ", cacheFilename), true)
+	log.LogStd(i18n.Tr("cli.cache_file", cacheFilename), true)
 
-	config := &bolt.Options{Timeout: 1 * time.Second}
-	appdb, err = bolt.Open(cacheFilename, 0600, config)
-	if err != nil {
-		panic(err)
-	}
+	cacheFile = cacheFilename
 	open = true
 	return nil
 }
 
 func closeDatabase() {
+	// Wait for the running transaction, if any
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
 	open = false
-	appdb.Close()
+	if appdb != nil {
+		appdb.Close()
+		appdb = nil
+	}
 }
 
 //Close gracefully closes the database
@@ -89,7 +91,7 @@ func Close() {
 
 //Save records a package details to the caching database
 func (p *OcaPackageDetail) Save() error {
-	err := appdb.Update(func(tx *bolt.Tx) error {
+	err := update(func(tx *bolt.Tx) error {
 		packages := tx.Bucket([]byte(bucketName))
 
 		enc, err := p.encode()
@@ -122,7 +124,7 @@ func decode(data []byte) (*OcaPackageDetail, error) {
 
 //ListPackages gets a list of packages from the database
 func ListPackages() {
-	appdb.View(func(tx *bolt.Tx) error {
+	view(func(tx *bolt.Tx) error {
 		c := tx.Bucket([]byte(bucketName)).Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			log.LogStd(fmt.Sprintf("key=%s", k), true)
@@ -132,13 +134,28 @@ func ListPackages() {
 	})
 }
 
+// PackageNumbers returns the numbers of every package in the cache, in order
+func PackageNumbers() ([]string, error) {
+	if !open {
+		return nil, fmt.Errorf("db must be opened before reading")
+	}
+	var numbers []string
+	err := view(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucketName)).ForEach(func(k, v []byte) error {
+			numbers = append(numbers, string(k))
+			return nil
+		})
+	})
+	return numbers, err
+}
+
 //GetPackage returns a single package by code
 func GetPackage(code string) (*OcaPackageDetail, error) {
 	if !open {
 		return nil, fmt.Errorf("db must be opened before saving")
 	}
 	var p *OcaPackageDetail
-	err := appdb.View(func(tx *bolt.Tx) error {
+	err := view(func(tx *bolt.Tx) error {
 		var err error
 		bucket := tx.Bucket([]byte(bucketName))
 		key := []byte(code)
@@ -162,13 +179,20 @@ func GetPackage(code string) (*OcaPackageDetail, error) {
 // CreateBucket adds the application bucket to the caching database
 func CreateBucket(cacheFilename string) {
 	createDatabase(cacheFilename)
-	appdb.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(bucketName))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		return nil
+	err := withDB(true, func(db *bolt.DB) error {
+		return db.Update(func(tx *bolt.Tx) error {
+			for _, name := range []string{bucketName, subscriptionsBucketName, retriesBucketName, threadsBucketName, digestsBucketName, heldBucketName, stallsBucketName, slaBucketName, pickupsBucketName, exceptionsBucketName, metaBucketName, mutesBucketName} {
+				_, err := tx.CreateBucketIfNotExists([]byte(name))
+				if err != nil {
+					return fmt.Errorf("create bucket: %s", err)
+				}
+			}
+			return nil
+		})
 	})
+	if err != nil {
+		panic(err)
+	}
 }
 
 //DiffWith compares the structure of the package log with another package
@@ -204,7 +228,41 @@ func (p *OcaPackageDetail) DiffWith(packageDetails OcaPackageDetail) ([]DetailLo
 	return diff, foundFlag
 }
 
-// SetAppDb sets the database for caching
-func SetAppDb(db *bolt.DB) {
-	appdb = db
+//LastMovement returns the most recent movement in the package log
+func (p *OcaPackageDetail) LastMovement() (DetailLog, bool) {
+	movements := p.Data[0].Log
+	if len(movements) == 0 {
+		return DetailLog{}, false
+	}
+	return movements[len(movements)-1], true
+}
+
+// ocaDateLayouts are the date formats found in the OCA movements
+var ocaDateLayouts = []string{
+	"02/01/2006 15:04",
+	"02/01/2006 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// ocaLocation is the timezone of the dates in the OCA movements
+var ocaLocation = loadOcaLocation()
+
+func loadOcaLocation() *time.Location {
+	location, err := time.LoadLocation("America/Argentina/Buenos_Aires")
+	if err != nil {
+		return time.FixedZone("ART", -3*60*60)
+	}
+	return location
+}
+
+//Time returns the date of the movement, which OCA gives in Argentine time
+func (d DetailLog) Time() (time.Time, bool) {
+	for _, layout := range ocaDateLayouts {
+		t, err := time.ParseInLocation(layout, d.Date, ocaLocation)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
 }
@@ -0,0 +1,66 @@
+package caching
+
+import (
+	"time"
+)
+
+const (
+	digestsBucketName = "digests"
+)
+
+// Digest collects the changes to summarize for a channel
+type Digest struct {
+	// LastSent is when the previous digest was sent
+	LastSent time.Time `json:"last_sent"`
+	// Movements holds the new movements of each package since LastSent
+	Movements map[string][]DetailLog `json:"movements"`
+}
+
+// GetDigest returns the digest being collected for a channel. The second
+// value is false when the channel has no digest yet.
+func GetDigest(channel string) (Digest, bool, error) {
+	var d Digest
+	found, err := loadRecord(digestsBucketName, channel, &d)
+	return d, found, err
+}
+
+// SaveDigest replaces the digest of a channel
+func SaveDigest(channel string, d Digest) error {
+	return saveRecord(digestsBucketName, channel, d)
+}
+
+// AddToDigest appends the movements of a package to the digest of a channel
+func AddToDigest(channel string, code string, movements []DetailLog) error {
+	d, found, err := GetDigest(channel)
+	if err != nil {
+		return err
+	}
+	if !found {
+		d.LastSent = time.Now()
+	}
+	if d.Movements == nil {
+		d.Movements = make(map[string][]DetailLog)
+	}
+	d.Movements[code] = appendMovements(d.Movements[code], movements)
+	return SaveDigest(channel, d)
+}
+
+// appendMovements adds to a list the movements it does not have yet. A
+// movement is identified by its date and description.
+func appendMovements(list []DetailLog, movements []DetailLog) []DetailLog {
+	for _, movement := range movements {
+		if !containsMovement(list, movement) {
+			list = append(list, movement)
+		}
+	}
+	return list
+}
+
+func containsMovement(list []DetailLog, movement DetailLog) bool {
+	for _, item := range list {
+		if item == movement {
+			return true
+		}
+	}
+	return false
+}
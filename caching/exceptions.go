@@ -0,0 +1,63 @@
+package caching
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	exceptionsBucketName = "exceptions"
+)
+
+// Exception flags a package with a problem, until someone acknowledges it
+type Exception struct {
+	Movement DetailLog `json:"movement"`
+	Since    time.Time `json:"since"`
+}
+
+// FlagException flags a package with an exception. A package already
+// flagged keeps the date of the first one.
+func FlagException(code string, exception Exception) error {
+	var existing Exception
+	found, err := loadRecord(exceptionsBucketName, code, &existing)
+	if err != nil {
+		return err
+	}
+	if found {
+		exception.Since = existing.Since
+	}
+	return saveRecord(exceptionsBucketName, code, exception)
+}
+
+// GetExceptions returns the packages flagged with an exception
+func GetExceptions() (map[string]Exception, error) {
+	if !open {
+		return nil, fmt.Errorf("db must be opened before reading")
+	}
+	exceptions := make(map[string]Exception)
+	err := view(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(exceptionsBucketName)).ForEach(func(k, v []byte) error {
+			var e Exception
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			exceptions[string(k)] = e
+			return nil
+		})
+	})
+	return exceptions, err
+}
+
+// AcknowledgeException removes the flag of a package and tells whether it
+// was flagged
+func AcknowledgeException(code string) (bool, error) {
+	var e Exception
+	found, err := loadRecord(exceptionsBucketName, code, &e)
+	if err != nil || !found {
+		return false, err
+	}
+	return true, deleteRecord(exceptionsBucketName, code)
+}
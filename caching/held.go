@@ -0,0 +1,110 @@
+package caching
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	heldBucketName = "held"
+)
+
+// HeldNotification is a change held back by quiet hours or rate limits,
+// to be notified later
+type HeldNotification struct {
+	// Channel is the channel to notify. It is empty when every channel was held.
+	Channel string `json:"channel"`
+	// Recipient is the email address to notify, for email changes held for a
+	// single recipient
+	Recipient string `json:"recipient"`
+	Code      string `json:"code"`
+	// Diff holds the movements to notify. It is nil when the whole log has to be sent.
+	Diff  []DetailLog `json:"diff"`
+	Event string      `json:"event"`
+	Since time.Time   `json:"since"`
+	// Channels limits the channels of a change held for every channel, as
+	// set by a rule. Nil means every channel.
+	Channels []string `json:"channels"`
+	// Priority is the priority set by a rule, if any
+	Priority int `json:"priority"`
+}
+
+// Key identifies the held notification. Changes with the same key are merged.
+func (h HeldNotification) Key() string {
+	return h.Channel + "|" + h.Recipient + "|" + h.Code
+}
+
+// Hold stores a change to notify later, merging it with the change already
+// held for the same channel, recipient and package
+func Hold(h HeldNotification) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving")
+	}
+	return update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(heldBucketName))
+		if value := bucket.Get([]byte(h.Key())); value != nil {
+			var existing HeldNotification
+			if err := json.Unmarshal(value, &existing); err != nil {
+				return err
+			}
+			h.Since = existing.Since
+			if existing.Diff == nil || h.Diff == nil {
+				h.Diff = nil
+			} else {
+				h.Diff = appendMovements(existing.Diff, h.Diff)
+			}
+			// Alerts without movements, like stuck, give way to a change
+			// with movements, which has no event. Between two alerts the
+			// newest wins.
+			if existing.Event == "" {
+				h.Event = ""
+			}
+			if existing.Channels == nil || h.Channels == nil {
+				h.Channels = nil
+			} else {
+				for _, channel := range existing.Channels {
+					if !contains(h.Channels, channel) {
+						h.Channels = append(h.Channels, channel)
+					}
+				}
+			}
+			if existing.Priority > h.Priority {
+				h.Priority = existing.Priority
+			}
+		}
+		return putJSON(bucket, h.Key(), h)
+	})
+}
+
+// GetHeld returns every held notification
+func GetHeld() ([]HeldNotification, error) {
+	if !open {
+		return nil, fmt.Errorf("db must be opened before reading")
+	}
+	var held []HeldNotification
+	err := view(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(heldBucketName)).ForEach(func(k, v []byte) error {
+			var h HeldNotification
+			if err := json.Unmarshal(v, &h); err != nil {
+				return err
+			}
+			held = append(held, h)
+			return nil
+		})
+	})
+	return held, err
+}
+
+// IsHeld tells whether a change of a package is held for every channel
+func IsHeld(code string) (bool, error) {
+	var h HeldNotification
+	return loadRecord(heldBucketName, HeldNotification{Code: code}.Key(), &h)
+}
+
+// Release removes a held notification once it is delivered
+func Release(h HeldNotification) error {
+	return deleteRecord(heldBucketName, h.Key())
+}
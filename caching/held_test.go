@@ -0,0 +1,80 @@
+package caching
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHoldMergesEvents(t *testing.T) {
+	newTestCache(t)
+	since := time.Date(2026, 10, 19, 22, 0, 0, 0, time.UTC)
+	moved := DetailLog{Date: "19/10/2026 23:00", Description: "En tránsito"}
+	delivered := DetailLog{Date: "20/10/2026 10:00", Description: "Entregado"}
+
+	tests := []struct {
+		name    string
+		first   HeldNotification
+		second  HeldNotification
+		event   string
+		changes int
+	}{
+		{
+			name:    "movement after stuck",
+			first:   HeldNotification{Code: "1", Diff: []DetailLog{}, Event: "stuck"},
+			second:  HeldNotification{Code: "1", Diff: []DetailLog{moved}},
+			event:   "",
+			changes: 1,
+		},
+		{
+			name:    "stuck after movement",
+			first:   HeldNotification{Code: "2", Diff: []DetailLog{moved}},
+			second:  HeldNotification{Code: "2", Diff: []DetailLog{}, Event: "stuck"},
+			event:   "",
+			changes: 1,
+		},
+		{
+			name:    "same movement twice",
+			first:   HeldNotification{Code: "4", Diff: []DetailLog{moved}},
+			second:  HeldNotification{Code: "4", Diff: []DetailLog{moved, delivered}},
+			event:   "",
+			changes: 2,
+		},
+		{
+			name:    "two alerts",
+			first:   HeldNotification{Code: "3", Diff: []DetailLog{}, Event: "sla_warning"},
+			second:  HeldNotification{Code: "3", Diff: []DetailLog{}, Event: "sla_breach"},
+			event:   "sla_breach",
+			changes: 0,
+		},
+	}
+	for _, test := range tests {
+		test.first.Since, test.second.Since = since, since.Add(time.Hour)
+		if err := Hold(test.first); err != nil {
+			t.Fatal(err)
+		}
+		if err := Hold(test.second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	held, err := GetHeld()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byCode := make(map[string]HeldNotification)
+	for _, h := range held {
+		byCode[h.Code] = h
+	}
+	for _, test := range tests {
+		h := byCode[test.first.Code]
+		if h.Event != test.event {
+			t.Errorf("%s: event = %q, want %q", test.name, h.Event, test.event)
+		}
+		if len(h.Diff) != test.changes {
+			t.Errorf("%s: %d movements, want %d", test.name, len(h.Diff), test.changes)
+		}
+		if !h.Since.Equal(since) {
+			t.Errorf("%s: held since %s, want the first change", test.name, h.Since)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package caching
+
+const (
+	metaBucketName = "meta"
+)
+
+// PackageMeta holds what gocafier knows about a package besides its OCA data
+type PackageMeta struct {
+	// Tags are the tags added by the rules and from the command line
+	Tags []string `json:"tags"`
+	// Archived packages are no longer polled
+	Archived bool `json:"archived"`
+	// Label, Notes, Owner, Created and ExpectedDelivery are set from the
+	// command line and win over the config file. The dates use the
+	// YYYY-MM-DD format.
+	Label            string `json:"label,omitempty"`
+	Notes            string `json:"notes,omitempty"`
+	Owner            string `json:"owner,omitempty"`
+	Created          string `json:"created,omitempty"`
+	ExpectedDelivery string `json:"expected_delivery,omitempty"`
+}
+
+// GetMeta returns the metadata of a package. It is empty when there is none.
+func GetMeta(code string) (PackageMeta, error) {
+	var meta PackageMeta
+	_, err := loadRecord(metaBucketName, code, &meta)
+	return meta, err
+}
+
+// SaveMeta records the metadata of a package
+func SaveMeta(code string, meta PackageMeta) error {
+	return saveRecord(metaBucketName, code, meta)
+}
+
+// AddTags adds tags to a list, skipping the ones already in it, and tells
+// whether any was added
+func AddTags(tags []string, added ...string) ([]string, bool) {
+	changed := false
+	for _, tag := range added {
+		if !contains(tags, tag) {
+			tags = append(tags, tag)
+			changed = true
+		}
+	}
+	return tags, changed
+}
+
+// RemoveTags removes tags from a list and tells whether any was removed
+func RemoveTags(tags []string, removed ...string) ([]string, bool) {
+	var kept []string
+	for _, tag := range tags {
+		if !contains(removed, tag) {
+			kept = append(kept, tag)
+		}
+	}
+	return kept, len(kept) != len(tags)
+}
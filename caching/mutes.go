@@ -0,0 +1,93 @@
+package caching
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	mutesBucketName = "mutes"
+)
+
+// Mute silences the notifications of a package. A zero Until silences them
+// until the mute is removed.
+type Mute struct {
+	Until time.Time `json:"until"`
+}
+
+// Active tells whether the mute still silences the notifications
+func (m Mute) Active(now time.Time) bool {
+	return m.Until.IsZero() || now.Before(m.Until)
+}
+
+// Mutes are the mutes of a package. The package is still polled and its
+// history kept while muted.
+type Mutes struct {
+	// Package silences the package for every recipient and channel
+	Package *Mute `json:"package,omitempty"`
+	// Recipients silences it for some email addresses only, in lower case
+	Recipients map[string]Mute `json:"recipients,omitempty"`
+}
+
+// PackageMuted tells whether the package is muted for everyone
+func (m Mutes) PackageMuted(now time.Time) bool {
+	return m.Package != nil && m.Package.Active(now)
+}
+
+// Muted tells whether the package is muted for an email address
+func (m Mutes) Muted(address string, now time.Time) bool {
+	if m.PackageMuted(now) {
+		return true
+	}
+	mute, found := m.Recipients[strings.ToLower(address)]
+	return found && mute.Active(now)
+}
+
+// GetMutes returns the mutes of a package. It is empty when there are none.
+func GetMutes(code string) (Mutes, error) {
+	var mutes Mutes
+	_, err := loadRecord(mutesBucketName, code, &mutes)
+	return mutes, err
+}
+
+// SetMute mutes a package until the given time, or until it is unmuted when
+// zero. An empty address mutes it for everyone.
+func SetMute(code string, address string, until time.Time) error {
+	mutes, err := GetMutes(code)
+	if err != nil {
+		return err
+	}
+	if address == "" {
+		mutes.Package = &Mute{Until: until}
+	} else {
+		if mutes.Recipients == nil {
+			mutes.Recipients = make(map[string]Mute)
+		}
+		mutes.Recipients[strings.ToLower(address)] = Mute{Until: until}
+	}
+	return saveRecord(mutesBucketName, code, mutes)
+}
+
+// Unmute removes the mute of a package, or the one of an address, and tells
+// whether there was one
+func Unmute(code string, address string) (bool, error) {
+	mutes, err := GetMutes(code)
+	if err != nil {
+		return false, err
+	}
+	key := strings.ToLower(address)
+	found := false
+	if address == "" {
+		found = mutes.Package != nil
+		mutes.Package = nil
+	} else if _, found = mutes.Recipients[key]; found {
+		delete(mutes.Recipients, key)
+	}
+	if !found {
+		return false, nil
+	}
+	if mutes.Package == nil && len(mutes.Recipients) == 0 {
+		return true, deleteRecord(mutesBucketName, code)
+	}
+	return true, saveRecord(mutesBucketName, code, mutes)
+}
@@ -0,0 +1,111 @@
+package caching
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// newTestCache creates a cache in a temporary directory, removed with the test
+func newTestCache(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gocafier-caching")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "cache.db")
+	CreateBucket(path)
+	t.Cleanup(func() {
+		Close()
+		os.RemoveAll(dir)
+	})
+	return path
+}
+
+// TestMuteWhileOpenElsewhere mutes a package the way the CLI does while
+// another process, like the poller, also uses the cache. Bolt locks the file
+// for each open handle, so the second handle stands for the other process
+func TestMuteWhileOpenElsewhere(t *testing.T) {
+	path := newTestCache(t)
+
+	now := time.Now()
+	if err := SetMute("123123123123", "", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache is not held between transactions
+	poller, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("the file is still locked after muting: %s", err)
+	}
+	err = poller.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(mutesBucketName)).Get([]byte("123123123123")) == nil {
+			t.Error("the other process does not see the mute")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// While the other process holds the file, the command waits for it
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		close(released)
+		poller.Close()
+	}()
+	unmuted, err := Unmute("123123123123", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-released:
+	default:
+		t.Error("unmuted while the other process held the file")
+	}
+	if !unmuted {
+		t.Error("the package was not muted")
+	}
+	mutes, err := GetMutes("123123123123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mutes.PackageMuted(now) {
+		t.Error("the package is still muted")
+	}
+}
+
+// TestSetAppDb keeps working for callers that open the database themselves
+func TestSetAppDb(t *testing.T) {
+	path := newTestCache(t)
+	Close()
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetAppDb(db)
+	if err = SetMute("123123123123", "", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(mutesBucketName)).Get([]byte("123123123123")) == nil {
+			t.Error("the mute was not saved in the database set")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Close()
+	reopened, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Close did not close the database set: %s", err)
+	}
+	reopened.Close()
+}
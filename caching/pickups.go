@@ -0,0 +1,32 @@
+package caching
+
+import (
+	"time"
+)
+
+const (
+	pickupsBucketName = "pickups"
+)
+
+// Pickup records the reminders sent for a package waiting at a branch
+type Pickup struct {
+	// Arrival is the movement that put the package at the branch. A different
+	// one means a new pickup.
+	Arrival      DetailLog `json:"arrival"`
+	LastReminder time.Time `json:"last_reminder"`
+}
+
+// GetPickup returns the pickup recorded for a package, or nil if there is none
+func GetPickup(code string) (*Pickup, error) {
+	var p Pickup
+	found, err := loadRecord(pickupsBucketName, code, &p)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SavePickup records the reminders sent for a package waiting at a branch
+func SavePickup(code string, pickup Pickup) error {
+	return saveRecord(pickupsBucketName, code, pickup)
+}
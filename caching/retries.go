@@ -0,0 +1,134 @@
+package caching
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	retriesBucketName = "retries"
+	// emailChannel is the notifier whose pending recipients are tracked
+	emailChannel = "email"
+)
+
+// PendingNotification holds a change that some channels failed to deliver
+type PendingNotification struct {
+	Channels []string `json:"channels"`
+	// Recipients holds the email recipients that did not get the change.
+	// It is nil when none of them got it.
+	Recipients []string `json:"recipients,omitempty"`
+	// Diff holds the movements to notify. It is nil when the whole log has to be sent.
+	Diff []DetailLog `json:"diff"`
+	// Event overrides the event type of the change, e.g. for stuck alerts
+	Event string `json:"event"`
+	// Priority is the priority set by a rule, if any
+	Priority int `json:"priority"`
+}
+
+// AddPending records the channels that failed to notify a change of a package,
+// merging it with any notification already pending for it
+func AddPending(code string, failed PendingNotification) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving")
+	}
+	return update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(retriesBucketName))
+		pending := PendingNotification{Recipients: failed.Recipients, Diff: failed.Diff, Event: failed.Event, Priority: failed.Priority}
+		if value := bucket.Get([]byte(code)); value != nil {
+			var existing PendingNotification
+			if err := json.Unmarshal(value, &existing); err != nil {
+				return err
+			}
+			pending.Channels = existing.Channels
+			pending.Recipients = mergeRecipients(existing, failed)
+			if existing.Diff == nil || failed.Diff == nil {
+				pending.Diff = nil
+			} else {
+				pending.Diff = appendMovements(existing.Diff, failed.Diff)
+			}
+			if existing.Priority > pending.Priority {
+				pending.Priority = existing.Priority
+			}
+		}
+		for _, channel := range failed.Channels {
+			if !contains(pending.Channels, channel) {
+				pending.Channels = append(pending.Channels, channel)
+			}
+		}
+		return putJSON(bucket, code, pending)
+	})
+}
+
+// mergeRecipients joins the email recipients of two pending notifications.
+// A notification whose email failed for every recipient wins.
+func mergeRecipients(existing, failed PendingNotification) []string {
+	if !contains(failed.Channels, emailChannel) {
+		return existing.Recipients
+	}
+	if !contains(existing.Channels, emailChannel) {
+		return failed.Recipients
+	}
+	if existing.Recipients == nil || failed.Recipients == nil {
+		return nil
+	}
+	recipients := existing.Recipients
+	for _, recipient := range failed.Recipients {
+		if !contains(recipients, recipient) {
+			recipients = append(recipients, recipient)
+		}
+	}
+	return recipients
+}
+
+// SetPending replaces the pending notification of a package.
+// An empty channel list removes it.
+func SetPending(code string, pending PendingNotification) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving")
+	}
+	return update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(retriesBucketName))
+		if len(pending.Channels) == 0 {
+			return bucket.Delete([]byte(code))
+		}
+		return putJSON(bucket, code, pending)
+	})
+}
+
+// GetPending returns every pending notification by package code
+func GetPending() (map[string]PendingNotification, error) {
+	if !open {
+		return nil, fmt.Errorf("db must be opened before reading")
+	}
+	pending := make(map[string]PendingNotification)
+	err := view(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(retriesBucketName)).ForEach(func(k, v []byte) error {
+			var p PendingNotification
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			pending[string(k)] = p
+			return nil
+		})
+	})
+	return pending, err
+}
+
+func putJSON(bucket *bolt.Bucket, key string, value interface{}) error {
+	enc, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %s", key, err)
+	}
+	return bucket.Put([]byte(key), enc)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
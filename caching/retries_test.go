@@ -0,0 +1,90 @@
+package caching
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddPendingMergesRecipients(t *testing.T) {
+	newTestCache(t)
+
+	tests := []struct {
+		name       string
+		first      PendingNotification
+		second     PendingNotification
+		channels   []string
+		recipients []string
+	}{
+		{
+			name:       "two partial email failures",
+			first:      PendingNotification{Channels: []string{"email"}, Recipients: []string{"a@example.com"}},
+			second:     PendingNotification{Channels: []string{"email"}, Recipients: []string{"b@example.com", "a@example.com"}},
+			channels:   []string{"email"},
+			recipients: []string{"a@example.com", "b@example.com"},
+		},
+		{
+			name:       "partial after a full email failure",
+			first:      PendingNotification{Channels: []string{"email"}},
+			second:     PendingNotification{Channels: []string{"email"}, Recipients: []string{"a@example.com"}},
+			channels:   []string{"email"},
+			recipients: nil,
+		},
+		{
+			name:       "another channel keeps the recipients",
+			first:      PendingNotification{Channels: []string{"email"}, Recipients: []string{"a@example.com"}},
+			second:     PendingNotification{Channels: []string{"slack"}},
+			channels:   []string{"email", "slack"},
+			recipients: []string{"a@example.com"},
+		},
+		{
+			name:       "email after another channel",
+			first:      PendingNotification{Channels: []string{"slack"}},
+			second:     PendingNotification{Channels: []string{"email"}, Recipients: []string{"a@example.com"}},
+			channels:   []string{"slack", "email"},
+			recipients: []string{"a@example.com"},
+		},
+	}
+	for i, test := range tests {
+		code := string(rune('1' + i))
+		if err := AddPending(code, test.first); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddPending(code, test.second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, err := GetPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		p := pending[string(rune('1'+i))]
+		if !reflect.DeepEqual(p.Channels, test.channels) {
+			t.Errorf("%s: channels = %v, want %v", test.name, p.Channels, test.channels)
+		}
+		if !reflect.DeepEqual(p.Recipients, test.recipients) {
+			t.Errorf("%s: recipients = %v, want %v", test.name, p.Recipients, test.recipients)
+		}
+	}
+}
+
+func TestAddPendingMergesMovements(t *testing.T) {
+	newTestCache(t)
+	moved := DetailLog{Date: "19/10/2026 23:00", Description: "En tránsito"}
+	delivered := DetailLog{Date: "20/10/2026 10:00", Description: "Entregado"}
+
+	if err := AddPending("1", PendingNotification{Channels: []string{"slack"}, Diff: []DetailLog{moved}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddPending("1", PendingNotification{Channels: []string{"slack"}, Diff: []DetailLog{moved, delivered}}); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := GetPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := pending["1"].Diff; !reflect.DeepEqual(diff, []DetailLog{moved, delivered}) {
+		t.Errorf("movements = %v, want each movement once", diff)
+	}
+}
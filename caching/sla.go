@@ -0,0 +1,24 @@
+package caching
+
+const (
+	slaBucketName = "sla"
+)
+
+// SLAAlert records the SLA notifications sent for a package, so each one
+// is sent once
+type SLAAlert struct {
+	Warned   bool `json:"warned"`
+	Breached bool `json:"breached"`
+}
+
+// GetSLAAlert returns the SLA notifications sent for a package
+func GetSLAAlert(code string) (SLAAlert, error) {
+	var alert SLAAlert
+	_, err := loadRecord(slaBucketName, code, &alert)
+	return alert, err
+}
+
+// SaveSLAAlert records the SLA notifications sent for a package
+func SaveSLAAlert(code string, alert SLAAlert) error {
+	return saveRecord(slaBucketName, code, alert)
+}
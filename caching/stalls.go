@@ -0,0 +1,33 @@
+package caching
+
+import (
+	"time"
+)
+
+const (
+	stallsBucketName = "stalls"
+)
+
+// Stall records the stuck alert sent for a package, so it fires once per stall
+type Stall struct {
+	// Movement is the last movement of the package when the alert was sent.
+	// A different last movement means a new stall.
+	Movement  DetailLog `json:"movement"`
+	AlertedAt time.Time `json:"alerted_at"`
+	Reminded  bool      `json:"reminded"`
+}
+
+// GetStall returns the stall alerted for a package, or nil if there is none
+func GetStall(code string) (*Stall, error) {
+	var s Stall
+	found, err := loadRecord(stallsBucketName, code, &s)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveStall records the stall alerted for a package
+func SaveStall(code string, stall Stall) error {
+	return saveRecord(stallsBucketName, code, stall)
+}
@@ -0,0 +1,117 @@
+package caching
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// lockTimeout is how long a transaction waits for another gocafier process
+// to release the cache file
+const lockTimeout = 10 * time.Second
+
+// cacheFile is the path of the cache. The file is only opened for the length
+// of each transaction, so the CLI commands can use it while the poller runs
+var cacheFile string
+
+// dbMutex keeps the goroutines of this process from opening the file at once,
+// since Bolt locks it for the whole process
+var dbMutex sync.Mutex
+
+// appdb is the database set by SetAppDb, used instead of opening cacheFile
+var appdb *bolt.DB
+
+// SetAppDb sets the database for caching. Every transaction then uses it,
+// and Close closes it, instead of opening the cache file each time.
+//
+// Deprecated: an open database keeps the file locked, so the CLI commands
+// cannot use the cache while the poller runs. Use CreateBucket with the path
+// of the cache instead.
+func SetAppDb(db *bolt.DB) {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+	appdb = db
+	open = db != nil
+}
+
+// withDB opens the cache, runs fn and closes it again. Read-only opens share
+// the file lock with other readers
+func withDB(writable bool, fn func(db *bolt.DB) error) error {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+	if appdb != nil {
+		return fn(appdb)
+	}
+	db, err := bolt.Open(cacheFile, 0600, &bolt.Options{Timeout: lockTimeout, ReadOnly: !writable})
+	if err != nil {
+		return fmt.Errorf("could not open cache %s: %s", cacheFile, err)
+	}
+	defer db.Close()
+	return fn(db)
+}
+
+// view runs a read-only transaction
+func view(fn func(tx *bolt.Tx) error) error {
+	return withDB(false, func(db *bolt.DB) error {
+		return db.View(fn)
+	})
+}
+
+// readOnly turns every write to the cache into a no-op
+var readOnly bool
+
+// SetReadOnly makes the cache read-only, so a dry run leaves it untouched
+func SetReadOnly(enabled bool) {
+	readOnly = enabled
+}
+
+// update runs a read-write transaction, unless the cache is read-only
+func update(fn func(tx *bolt.Tx) error) error {
+	if readOnly {
+		return nil
+	}
+	return withDB(true, func(db *bolt.DB) error {
+		return db.Update(fn)
+	})
+}
+
+// saveRecord stores a value as JSON under a key of a bucket
+func saveRecord(bucket string, key string, value interface{}) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving")
+	}
+	return update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket([]byte(bucket)), key, value)
+	})
+}
+
+// loadRecord decodes the value stored under a key of a bucket and tells
+// whether it was found
+func loadRecord(bucket string, key string, value interface{}) (bool, error) {
+	if !open {
+		return false, fmt.Errorf("db must be opened before reading")
+	}
+	found := false
+	err := view(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(bucket)).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, value)
+	})
+	return found, err
+}
+
+// deleteRecord removes a key from a bucket
+func deleteRecord(bucket string, key string) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving")
+	}
+	return update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Delete([]byte(key))
+	})
+}
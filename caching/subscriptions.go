@@ -0,0 +1,120 @@
+package caching
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	subscriptionsBucketName = "subscriptions"
+)
+
+// Subscriber represents someone who asked to be notified about a package
+type Subscriber struct {
+	Channel string `json:"channel"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+}
+
+// Subscribe registers a subscriber for the updates of a package.
+// Subscribing twice to the same package is a no-op.
+func Subscribe(code string, subscriber Subscriber) error {
+	return updateSubscribers(code, func(subscribers []Subscriber) []Subscriber {
+		for _, s := range subscribers {
+			if s.Channel == subscriber.Channel && s.ID == subscriber.ID {
+				return subscribers
+			}
+		}
+		return append(subscribers, subscriber)
+	})
+}
+
+// Unsubscribe removes a subscriber from the updates of a package
+func Unsubscribe(code string, subscriber Subscriber) error {
+	return updateSubscribers(code, func(subscribers []Subscriber) []Subscriber {
+		var kept []Subscriber
+		for _, s := range subscribers {
+			if s.Channel != subscriber.Channel || s.ID != subscriber.ID {
+				kept = append(kept, s)
+			}
+		}
+		return kept
+	})
+}
+
+// GetSubscribers returns the subscribers of a package
+func GetSubscribers(code string) ([]Subscriber, error) {
+	if !open {
+		return nil, fmt.Errorf("db must be opened before reading subscribers")
+	}
+	var subscribers []Subscriber
+	err := view(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(subscriptionsBucketName)).Get([]byte(code))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, &subscribers)
+	})
+	return subscribers, err
+}
+
+// SubscribedPackages returns the codes of every package with at least one subscriber
+func SubscribedPackages() ([]string, error) {
+	if !open {
+		return nil, fmt.Errorf("db must be opened before reading subscribers")
+	}
+	var codes []string
+	err := view(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(subscriptionsBucketName)).ForEach(func(k, v []byte) error {
+			codes = append(codes, string(k))
+			return nil
+		})
+	})
+	return codes, err
+}
+
+// PackagesFor returns the codes of the packages a subscriber is registered to
+func PackagesFor(subscriber Subscriber) ([]string, error) {
+	if !open {
+		return nil, fmt.Errorf("db must be opened before reading subscribers")
+	}
+	var codes []string
+	err := view(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(subscriptionsBucketName)).ForEach(func(k, v []byte) error {
+			var subscribers []Subscriber
+			if err := json.Unmarshal(v, &subscribers); err != nil {
+				return err
+			}
+			for _, s := range subscribers {
+				if s.Channel == subscriber.Channel && s.ID == subscriber.ID {
+					codes = append(codes, string(k))
+					break
+				}
+			}
+			return nil
+		})
+	})
+	return codes, err
+}
+
+func updateSubscribers(code string, change func([]Subscriber) []Subscriber) error {
+	if !open {
+		return fmt.Errorf("db must be opened before saving subscribers")
+	}
+	return update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(subscriptionsBucketName))
+		var subscribers []Subscriber
+		if value := bucket.Get([]byte(code)); value != nil {
+			if err := json.Unmarshal(value, &subscribers); err != nil {
+				return err
+			}
+		}
+		subscribers = change(subscribers)
+		if len(subscribers) == 0 {
+			return bucket.Delete([]byte(code))
+		}
+		return putJSON(bucket, code, subscribers)
+	})
+}
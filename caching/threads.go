@@ -0,0 +1,29 @@
+package caching
+
+const (
+	threadsBucketName = "threads"
+)
+
+// Thread holds the Message-IDs used to group the emails of a package
+// into a single conversation
+type Thread struct {
+	// Root is the Message-ID of the first notification of the package
+	Root string `json:"root"`
+	// Last is the Message-ID of the latest notification of the package
+	Last string `json:"last"`
+}
+
+// GetThread returns the email thread of a package, or nil if no email was sent yet
+func GetThread(code string) (*Thread, error) {
+	var t Thread
+	found, err := loadRecord(threadsBucketName, code, &t)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SaveThread records the email thread of a package
+func SaveThread(code string, thread Thread) error {
+	return saveRecord(threadsBucketName, code, thread)
+}
@@ -0,0 +1,195 @@
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout of the dates in the config file, e.g. 2026-07-10
+const DateLayout = "2006-01-02"
+
+// Holiday is a day without business activity
+type Holiday struct {
+	Date time.Time
+	Name string
+}
+
+// fixed are the national holidays that never move, as month and day
+var fixed = []struct {
+	month time.Month
+	day   int
+	name  string
+}{
+	{time.January, 1, "Año Nuevo"},
+	{time.March, 24, "Día Nacional de la Memoria por la Verdad y la Justicia"},
+	{time.April, 2, "Día del Veterano y de los Caídos en la Guerra de Malvinas"},
+	{time.May, 1, "Día del Trabajador"},
+	{time.May, 25, "Día de la Revolución de Mayo"},
+	{time.June, 20, "Paso a la Inmortalidad del General Manuel Belgrano"},
+	{time.July, 9, "Día de la Independencia"},
+	{time.December, 8, "Día de la Inmaculada Concepción de María"},
+	{time.December, 25, "Navidad"},
+}
+
+// movable are the national holidays moved to a Monday by law 27.399
+var movable = []struct {
+	month time.Month
+	day   int
+	name  string
+}{
+	{time.June, 17, "Paso a la Inmortalidad del General Martín Miguel de Güemes"},
+	{time.August, 17, "Paso a la Inmortalidad del General José de San Martín"},
+	{time.October, 12, "Día del Respeto a la Diversidad Cultural"},
+	{time.November, 20, "Día de la Soberanía Nacional"},
+}
+
+var extra = map[string]string{}
+var workdays = map[string]bool{}
+
+// Configure sets the holidays added to the built-in ones, and the days that
+// are business days even if they are holidays, e.g. a holiday moved by decree
+func Configure(holidays []Holiday, working []time.Time) {
+	extra = map[string]string{}
+	for _, h := range holidays {
+		extra[key(h.Date)] = h.Name
+	}
+	workdays = map[string]bool{}
+	for _, day := range working {
+		workdays[key(day)] = true
+	}
+}
+
+// Holidays returns the holidays of a year, in order
+func Holidays(year int) []Holiday {
+	days := holidays(year)
+	var list []Holiday
+	for k, name := range days {
+		date, _ := time.Parse(DateLayout, k)
+		list = append(list, Holiday{Date: date, Name: name})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Date.Before(list[j].Date) })
+	return list
+}
+
+// HolidayName returns the name of the holiday on the day of t, if it is one
+func HolidayName(t time.Time) (string, bool) {
+	name, ok := holidays(t.Year())[key(t)]
+	return name, ok
+}
+
+// IsBusinessDay tells whether the day of t is neither a weekend nor a holiday
+func IsBusinessDay(t time.Time) bool {
+	if workdays[key(t)] {
+		return true
+	}
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+	_, holiday := HolidayName(t)
+	return !holiday
+}
+
+// BusinessDays counts the business days from the day after from until the
+// day of to, both in the location of from
+func BusinessDays(from time.Time, to time.Time) int {
+	day := midnight(from)
+	end := midnight(to.In(from.Location()))
+	count := 0
+	for day = day.AddDate(0, 0, 1); !day.After(end); day = day.AddDate(0, 0, 1) {
+		if IsBusinessDay(day) {
+			count++
+		}
+	}
+	return count
+}
+
+// AddBusinessDays returns the time n business days after t, keeping its clock
+func AddBusinessDays(t time.Time, n int) time.Time {
+	for n > 0 {
+		t = t.AddDate(0, 0, 1)
+		if IsBusinessDay(t) {
+			n--
+		}
+	}
+	return t
+}
+
+// NextBusinessDay returns t if its day is a business day, or the same time
+// of the first business day after it
+func NextBusinessDay(t time.Time) time.Time {
+	for !IsBusinessDay(t) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// holidays returns the holidays of a year, keyed by date, with the
+// configured changes applied
+func holidays(year int) map[string]string {
+	days := map[string]string{}
+	for _, h := range fixed {
+		days[key(date(year, h.month, h.day))] = h.name
+	}
+	for _, h := range movable {
+		days[key(moveToMonday(date(year, h.month, h.day)))] = h.name
+	}
+	easter := easterSunday(year)
+	days[key(easter.AddDate(0, 0, -48))] = "Carnaval"
+	days[key(easter.AddDate(0, 0, -47))] = "Carnaval"
+	days[key(easter.AddDate(0, 0, -2))] = "Viernes Santo"
+	prefix := fmt.Sprintf("%04d-", year)
+	for k, name := range extra {
+		if strings.HasPrefix(k, prefix) {
+			days[k] = name
+		}
+	}
+	for k := range workdays {
+		delete(days, k)
+	}
+	return days
+}
+
+// moveToMonday moves the holidays on Tuesday or Wednesday to the previous
+// Monday, and the ones on Thursday or Friday to the next Monday
+func moveToMonday(t time.Time) time.Time {
+	switch t.Weekday() {
+	case time.Tuesday, time.Wednesday:
+		return t.AddDate(0, 0, -int(t.Weekday()-time.Monday))
+	case time.Thursday, time.Friday:
+		return t.AddDate(0, 0, int(time.Saturday-t.Weekday())+2)
+	}
+	return t
+}
+
+// easterSunday computes the date of Easter with the anonymous Gregorian algorithm
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return date(year, time.Month(month), day)
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func key(t time.Time) string {
+	return t.Format(DateLayout)
+}
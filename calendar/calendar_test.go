@@ -0,0 +1,92 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEasterSunday(t *testing.T) {
+	tests := []struct {
+		year int
+		want string
+	}{
+		{2000, "2000-04-23"},
+		{2016, "2016-03-27"},
+		{2019, "2019-04-21"},
+		{2024, "2024-03-31"},
+		{2025, "2025-04-20"},
+		{2026, "2026-04-05"},
+		{2027, "2027-03-28"},
+		{2038, "2038-04-25"},
+	}
+	for _, test := range tests {
+		if got := key(easterSunday(test.year)); got != test.want {
+			t.Errorf("easterSunday(%d) = %s, want %s", test.year, got, test.want)
+		}
+	}
+}
+
+func TestMoveToMonday(t *testing.T) {
+	tests := []struct {
+		day  string
+		want string
+	}{
+		{"2026-06-15", "2026-06-15"}, // Monday
+		{"2026-06-16", "2026-06-15"}, // Tuesday
+		{"2026-06-17", "2026-06-15"}, // Wednesday
+		{"2026-06-18", "2026-06-22"}, // Thursday
+		{"2026-06-19", "2026-06-22"}, // Friday
+		{"2026-06-20", "2026-06-20"}, // Saturday
+		{"2026-06-21", "2026-06-21"}, // Sunday
+	}
+	for _, test := range tests {
+		day, _ := time.Parse(DateLayout, test.day)
+		if got := key(moveToMonday(day)); got != test.want {
+			t.Errorf("moveToMonday(%s) = %s, want %s", test.day, got, test.want)
+		}
+	}
+}
+
+// TestHolidays checks the Easter and movable holidays against the official
+// Argentine calendars
+func TestHolidays(t *testing.T) {
+	Configure(nil, nil)
+	tests := []struct {
+		day     string
+		name    string
+		holiday bool
+	}{
+		{"2024-02-12", "Carnaval", true},
+		{"2024-02-13", "Carnaval", true},
+		{"2024-03-29", "Viernes Santo", true},
+		{"2024-06-17", "Paso a la Inmortalidad del General Martín Miguel de Güemes", true},
+		{"2024-08-17", "Paso a la Inmortalidad del General José de San Martín", true},
+		{"2024-11-18", "Día de la Soberanía Nacional", true},
+		{"2024-11-20", "", false},
+
+		{"2025-03-03", "Carnaval", true},
+		{"2025-03-04", "Carnaval", true},
+		{"2025-04-18", "Viernes Santo", true},
+		{"2025-06-16", "Paso a la Inmortalidad del General Martín Miguel de Güemes", true},
+		{"2025-06-17", "", false},
+		{"2025-11-24", "Día de la Soberanía Nacional", true},
+		{"2025-11-20", "", false},
+
+		{"2026-02-16", "Carnaval", true},
+		{"2026-02-17", "Carnaval", true},
+		{"2026-04-03", "Viernes Santo", true},
+		{"2026-06-15", "Paso a la Inmortalidad del General Martín Miguel de Güemes", true},
+		{"2026-06-17", "", false},
+		{"2026-08-17", "Paso a la Inmortalidad del General José de San Martín", true},
+		{"2026-10-12", "Día del Respeto a la Diversidad Cultural", true},
+		{"2026-11-23", "Día de la Soberanía Nacional", true},
+		{"2026-11-20", "", false},
+	}
+	for _, test := range tests {
+		day, _ := time.Parse(DateLayout, test.day)
+		name, holiday := HolidayName(day)
+		if holiday != test.holiday || name != test.name {
+			t.Errorf("HolidayName(%s) = %q, %t, want %q, %t", test.day, name, holiday, test.name, test.holiday)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var icalEscapes = strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+// ParseICal reads the holidays of the events of an iCalendar file, such as
+// the ones published by the government or by Google Calendar. Events that
+// last several days add a holiday for each day.
+func ParseICal(r io.Reader) ([]Holiday, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var list []Holiday
+	var inEvent bool
+	var start, end time.Time
+	var summary string
+	for n, line := range lines {
+		name, value := splitProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			inEvent = true
+			start, end, summary = time.Time{}, time.Time{}, ""
+		case name == "END" && value == "VEVENT":
+			inEvent = false
+			if start.IsZero() {
+				return nil, fmt.Errorf("line %d: event without DTSTART", n+1)
+			}
+			if !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+				list = append(list, Holiday{Date: day, Name: summary})
+			}
+		case !inEvent:
+		case name == "DTSTART" || name == "DTEND":
+			day, err := parseICalDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n+1, err)
+			}
+			if name == "DTSTART" {
+				start = day
+			} else {
+				end = day
+			}
+		case name == "SUMMARY":
+			summary = icalEscapes.Replace(value)
+		}
+	}
+	return list, nil
+}
+
+// unfold joins the lines that continue on the next one, which start with a
+// space or a tab
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitProperty returns the name of a property without its parameters, and
+// its value, e.g. DTSTART and 20260710 for DTSTART;VALUE=DATE:20260710
+func splitProperty(line string) (string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), ""
+	}
+	name := line[:colon]
+	if semicolon := strings.Index(name, ";"); semicolon >= 0 {
+		name = name[:semicolon]
+	}
+	return strings.ToUpper(name), line[colon+1:]
+}
+
+// parseICalDate returns the day of a DATE or DATE-TIME value. Only the date
+// is kept, since holidays last whole days.
+func parseICalDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	day, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return day, nil
+}
@@ -0,0 +1,234 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// DefaultHeaders are the headers signed when none are configured
+var DefaultHeaders = []string{"From", "To", "Cc", "Reply-To", "Subject", "Date", "Message-ID", "In-Reply-To", "References", "Mime-Version", "Content-Type"}
+
+// Signer adds a DKIM-Signature header to messages, using relaxed/relaxed canonicalization
+type Signer struct {
+	Domain   string
+	Selector string
+	Key      crypto.Signer
+	Headers  []string
+	// Now returns the signature timestamp. It can be replaced to get reproducible signatures.
+	Now func() time.Time
+}
+
+// NewSigner returns a signer that uses the PEM encoded RSA or Ed25519 private key at keyPath
+func NewSigner(domain string, selector string, keyPath string, headers []string) (*Signer, error) {
+	key, err := LoadKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) == 0 {
+		headers = DefaultHeaders
+	}
+	return &Signer{Domain: domain, Selector: selector, Key: key, Headers: headers, Now: time.Now}, nil
+}
+
+// LoadKey reads a PKCS#1 or PKCS#8 PEM private key
+func LoadKey(path string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("unsupported DKIM key type %T in %s", key, path)
+}
+
+// Sign returns the message with a DKIM-Signature header prepended
+func (s *Signer) Sign(message []byte) ([]byte, error) {
+	header, body := splitMessage(message)
+	fields := parseHeader(header)
+
+	var algorithm string
+	switch s.Key.(type) {
+	case *rsa.PrivateKey:
+		algorithm = "rsa-sha256"
+	case ed25519.PrivateKey:
+		algorithm = "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("unsupported DKIM key type %T", s.Key)
+	}
+
+	bodyHash := sha256.Sum256(canonicalBody(body))
+
+	// Each signed header is taken from the bottom of the message up, and
+	// headers missing from the message are not listed
+	hash := sha256.New()
+	var signed []string
+	used := make(map[int]bool)
+	for _, name := range s.Headers {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].name, name) {
+				used[i] = true
+				signed = append(signed, strings.ToLower(name))
+				io.WriteString(hash, canonicalHeader(fields[i].name, fields[i].value)+"\r\n")
+				break
+			}
+		}
+	}
+
+	value := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%d; h=%s; bh=%s; b=",
+		algorithm, s.Domain, s.Selector, s.Now().Unix(), strings.Join(signed, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+	io.WriteString(hash, canonicalHeader("DKIM-Signature", value))
+	digest := hash.Sum(nil)
+
+	var signature []byte
+	var err error
+	if _, ok := s.Key.(ed25519.PrivateKey); ok {
+		// RFC 8463 signs the SHA-256 digest with pure Ed25519
+		signature, err = s.Key.Sign(rand.Reader, digest, crypto.Hash(0))
+	} else {
+		signature, err = s.Key.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var signedMessage bytes.Buffer
+	fmt.Fprintf(&signedMessage, "DKIM-Signature: %s%s\r\n", value, base64.StdEncoding.EncodeToString(signature))
+	signedMessage.Write(message)
+	return signedMessage.Bytes(), nil
+}
+
+type field struct {
+	name  string
+	value string
+}
+
+func splitMessage(message []byte) ([]byte, []byte) {
+	if i := bytes.Index(message, []byte("\r\n\r\n")); i >= 0 {
+		return message[:i+2], message[i+4:]
+	}
+	return message, nil
+}
+
+func parseHeader(header []byte) []field {
+	var fields []field
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += line
+			continue
+		}
+		if i := strings.Index(line, ":"); i > 0 {
+			fields = append(fields, field{name: line[:i], value: line[i+1:]})
+		}
+	}
+	return fields
+}
+
+// canonicalHeader applies the relaxed header canonicalization of RFC 6376 3.4.2
+func canonicalHeader(name string, value string) string {
+	value = strings.Replace(value, "\r\n", "", -1)
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(collapseSpaces(value))
+}
+
+// canonicalBody applies the relaxed body canonicalization of RFC 6376 3.4.4
+func canonicalBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseSpaces(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func collapseSpaces(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// Sender signs every message before handing it to the next sender
+type Sender struct {
+	Signer *Signer
+	Next   gomail.Sender
+}
+
+type rawMessage []byte
+
+func (m rawMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(m)
+	return int64(n), err
+}
+
+// Send signs the message and delivers it through the next sender
+func (s *Sender) Send(from string, to []string, msg io.WriterTo) error {
+	var message bytes.Buffer
+	if _, err := msg.WriteTo(&message); err != nil {
+		return err
+	}
+	signed, err := s.Signer.Sign(message.Bytes())
+	if err != nil {
+		return fmt.Errorf("could not sign message: %s", err)
+	}
+	return s.Next.Send(from, to, rawMessage(signed))
+}
+
+// CloseCycle forwards the end of the poll cycle to the next sender
+func (s *Sender) CloseCycle() error {
+	if c, ok := s.Next.(interface {
+		CloseCycle() error
+	}); ok {
+		return c.CloseCycle()
+	}
+	return nil
+}
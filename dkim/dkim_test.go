@@ -0,0 +1,284 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// The verifier below is written apart from the signer, following RFC 6376
+// step by step, so both do not share a canonicalization bug
+
+var (
+	foldedLine   = regexp.MustCompile(`\r\n([ \t])`)
+	whitespace   = regexp.MustCompile(`[ \t]+`)
+	trailingWSP  = regexp.MustCompile(`[ \t]+\r\n`)
+	trailingCRLF = regexp.MustCompile(`(\r\n)+$`)
+	signatureTag = regexp.MustCompile(`(b=)[^;]*$`)
+)
+
+// verify checks the DKIM-Signature at the top of a message with the public key
+func verify(t *testing.T, message []byte, public crypto.PublicKey) {
+	t.Helper()
+	end := bytes.Index(message, []byte("\r\n\r\n"))
+	if end < 0 {
+		t.Fatal("message without header separator")
+	}
+	header, body := string(message[:end+2]), string(message[end+4:])
+
+	// Unfold the header lines and split them into fields
+	var names, values []string
+	for _, line := range strings.Split(strings.TrimSuffix(foldedLine.ReplaceAllString(header, "$1"), "\r\n"), "\r\n") {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			t.Fatalf("malformed header line %q", line)
+		}
+		names = append(names, line[:colon])
+		values = append(values, line[colon+1:])
+	}
+	if !strings.EqualFold(names[0], "DKIM-Signature") {
+		t.Fatalf("first header is %q, want DKIM-Signature", names[0])
+	}
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(values[0], ";") {
+		if kv := strings.SplitN(strings.TrimSpace(tag), "=", 2); len(kv) == 2 {
+			tags[kv[0]] = whitespace.ReplaceAllString(kv[1], "")
+		}
+	}
+	if tags["v"] != "1" || tags["c"] != "relaxed/relaxed" {
+		t.Errorf("v=%s c=%s, want v=1 c=relaxed/relaxed", tags["v"], tags["c"])
+	}
+
+	// Body hash: relaxed body canonicalization, RFC 6376 3.4.4
+	canonical := whitespace.ReplaceAllString(body, " ")
+	canonical = trailingWSP.ReplaceAllString(canonical, "\r\n")
+	canonical = strings.TrimRight(canonical, " \t")
+	canonical = trailingCRLF.ReplaceAllString(canonical, "")
+	if canonical != "" {
+		canonical += "\r\n"
+	}
+	bodyHash := sha256.Sum256([]byte(canonical))
+	if got := base64.StdEncoding.EncodeToString(bodyHash[:]); got != tags["bh"] {
+		t.Errorf("bh=%s, want %s", tags["bh"], got)
+	}
+
+	// Header hash: the fields of h=, from the bottom up, then the signature
+	// itself without the b= value
+	relaxed := func(name string, value string) string {
+		return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(whitespace.ReplaceAllString(value, " "))
+	}
+	hash := sha256.New()
+	used := make(map[int]bool)
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(names) - 1; i > 0; i-- {
+			if !used[i] && strings.EqualFold(names[i], name) {
+				used[i] = true
+				io.WriteString(hash, relaxed(names[i], values[i])+"\r\n")
+				break
+			}
+		}
+	}
+	io.WriteString(hash, relaxed(names[0], signatureTag.ReplaceAllString(values[0], "$1")))
+	digest := hash.Sum(nil)
+
+	signature, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		t.Fatalf("b= is not base64: %s", err)
+	}
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if tags["a"] != "rsa-sha256" {
+			t.Errorf("a=%s, want rsa-sha256", tags["a"])
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature); err != nil {
+			t.Errorf("RSA signature does not verify: %s", err)
+		}
+	case ed25519.PublicKey:
+		if tags["a"] != "ed25519-sha256" {
+			t.Errorf("a=%s, want ed25519-sha256", tags["a"])
+		}
+		if !ed25519.Verify(key, digest, signature) {
+			t.Error("Ed25519 signature does not verify")
+		}
+	}
+}
+
+func newSigners(t *testing.T) map[string]*Signer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := func() time.Time { return time.Unix(1700000000, 0) }
+	return map[string]*Signer{
+		"rsa":     {Domain: "example.com", Selector: "mail", Key: rsaKey, Headers: DefaultHeaders, Now: now},
+		"ed25519": {Domain: "example.com", Selector: "mail", Key: edKey, Headers: DefaultHeaders, Now: now},
+	}
+}
+
+func TestSignGomailMessage(t *testing.T) {
+	for name, signer := range newSigners(t) {
+		m := gomail.NewMessage()
+		m.SetHeader("From", "gocafier@example.com")
+		m.SetHeader("To", "uno@example.com", "dos@example.com")
+		m.SetHeader("Subject", strings.Repeat("Paquete OCA en distribución ", 6))
+		m.SetHeader("Message-ID", "<gocafier.1@example.com>")
+		m.SetHeader("References", "<gocafier.0@example.com> <gocafier.00@example.com>")
+		m.SetBody("text/plain", "Hay un update  del envío.\n\n\n")
+		m.AddAlternative("text/html", "<p>Hay un update del envío.</p>")
+
+		var sent bytes.Buffer
+		sender := &Sender{Signer: signer, Next: gomail.SendFunc(func(from string, to []string, msg io.WriterTo) error {
+			_, err := msg.WriteTo(&sent)
+			return err
+		})}
+		if err := gomail.Send(sender, m); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !bytes.Contains(sent.Bytes(), []byte("h=from:to:subject:date:message-id:references:mime-version:content-type;")) {
+			t.Errorf("%s: the signature does not cover the message headers", name)
+		}
+		verify(t, sent.Bytes(), signer.Key.Public())
+	}
+}
+
+func TestSignRawMessages(t *testing.T) {
+	messages := map[string]string{
+		"folded headers": "From: gocafier@example.com\r\n" +
+			"To: uno@example.com,\r\n\t dos@example.com\r\n" +
+			"Subject:   Paquete   OCA\r\n   en distribución  \r\n" +
+			"\r\n" +
+			"Hola\r\n",
+		"trailing blank lines": "From: gocafier@example.com\r\n" +
+			"Subject: Paquete\r\n" +
+			"\r\n" +
+			"Hola  \t mundo \r\n\r\n \r\n\r\n",
+		"no final line break": "From: gocafier@example.com\r\n" +
+			"Subject: Paquete\r\n" +
+			"\r\n" +
+			"Hola\r\nmundo",
+		"empty body": "From: gocafier@example.com\r\n" +
+			"Subject: Paquete\r\n" +
+			"\r\n",
+		"duplicated header": "From: gocafier@example.com\r\n" +
+			"Subject: primero\r\n" +
+			"Subject: segundo\r\n" +
+			"\r\n" +
+			"Hola\r\n",
+	}
+	for name, signer := range newSigners(t) {
+		for test, message := range messages {
+			signed, err := signer.Sign([]byte(message))
+			if err != nil {
+				t.Fatalf("%s, %s: %s", name, test, err)
+			}
+			if !bytes.HasSuffix(signed, []byte(message)) {
+				t.Errorf("%s, %s: the message changed after signing", name, test)
+			}
+			t.Run(name+"/"+test, func(t *testing.T) {
+				verify(t, signed, signer.Key.Public())
+			})
+		}
+	}
+}
+
+func TestBodyHashIgnoresTrailingBlankLines(t *testing.T) {
+	signer := newSigners(t)["ed25519"]
+	bh := func(body string) string {
+		signed, err := signer.Sign([]byte("From: a@example.com\r\n\r\n" + body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return regexp.MustCompile(`bh=([^;]+);`).FindStringSubmatch(string(signed))[1]
+	}
+	if bh("Hola mundo\r\n") != bh("Hola   mundo \r\n\r\n\r\n") {
+		t.Error("relaxed bodies that only differ in whitespace and blank lines have different hashes")
+	}
+	// The hash of an empty body is the one of the empty string
+	empty := sha256.Sum256(nil)
+	if got := bh(""); got != base64.StdEncoding.EncodeToString(empty[:]) {
+		t.Errorf("empty body bh=%s", got)
+	}
+	if bh("\r\n\r\n") != bh("") {
+		t.Error("a body of blank lines is not the same as an empty one")
+	}
+}
+
+func TestSignOnlyPresentHeaders(t *testing.T) {
+	signer := newSigners(t)["rsa"]
+	signed, err := signer.Sign([]byte("From: a@example.com\r\nSubject: s\r\n\r\nbody\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(signed, []byte("h=from:subject;")) {
+		t.Errorf("signature %q should only list the headers of the message", signed[:bytes.Index(signed, []byte("\r\n"))])
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocafier-dkim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	pkcs8RSA, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	pkcs8Ed, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	keys := map[string]*pem.Block{
+		"pkcs1.pem":   {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		"pkcs8.pem":   {Type: "PRIVATE KEY", Bytes: pkcs8RSA},
+		"ed25519.pem": {Type: "PRIVATE KEY", Bytes: pkcs8Ed},
+	}
+	for file, block := range keys {
+		path := filepath.Join(dir, file)
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		signer, err := NewSigner("example.com", "mail", path, nil)
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+		signed, err := signer.Sign([]byte("From: a@example.com\r\n\r\nbody\r\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		verify(t, signed, signer.Key.Public())
+	}
+
+	path := filepath.Join(dir, "empty.pem")
+	ioutil.WriteFile(path, []byte("not a key"), 0600)
+	if _, err := LoadKey(path); err == nil {
+		t.Error("a file without PEM data was loaded")
+	}
+}
+
+func ExampleSigner_Sign() {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer := &Signer{Domain: "example.com", Selector: "mail", Key: key, Headers: []string{"From", "Subject"}, Now: func() time.Time { return time.Unix(0, 0) }}
+	signed, _ := signer.Sign([]byte("From: a@example.com\r\nSubject: hola\r\n\r\nbody\r\n"))
+	fmt.Println(strings.SplitN(string(signed), "; b=", 2)[0])
+	// Output: DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed; d=example.com; s=mail; t=0; h=from:subject; bh=Ck5SoRNWUpSR4X0COv7R5ub2pUTtl6xz4dTFz++ji4M=
+}
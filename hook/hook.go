@@ -0,0 +1,164 @@
+package hook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/notifications"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// waitDelay is how long a timed out command may keep its output open,
+	// e.g. through a child that left its process group
+	waitDelay = 2 * time.Second
+)
+
+// Notifier runs a custom command for every package change. The change is
+// written as JSON to the command stdin and exposed as GOCAFIER_* variables.
+type Notifier struct {
+	Command string
+	Args    []string
+	Timeout time.Duration
+}
+
+type event struct {
+	Package string `json:"package"`
+	// Type is the OCA package type, e.g. paquetes
+	Type string `json:"type"`
+	// Event is the kind of change, e.g. new_movement, stuck or sla_breach
+	Event          string              `json:"event"`
+	Status         string              `json:"status"`
+	FirstSeen      bool                `json:"first_seen"`
+	NewEventsCount int                 `json:"new_events_count"`
+	LastEvent      caching.DetailLog   `json:"last_event"`
+	NewEvents      []caching.DetailLog `json:"new_events"`
+	Timeline       []caching.DetailLog `json:"timeline"`
+}
+
+type digestPackage struct {
+	Package   string              `json:"package"`
+	Status    string              `json:"status"`
+	LastEvent caching.DetailLog   `json:"last_event"`
+	NewEvents []caching.DetailLog `json:"new_events"`
+}
+
+type digest struct {
+	// Event is always "digest", like GOCAFIER_EVENT
+	Event string          `json:"event"`
+	Since time.Time       `json:"since"`
+	Until time.Time       `json:"until"`
+	Moved []digestPackage `json:"moved"`
+	Idle  []digestPackage `json:"idle"`
+}
+
+// Name returns the channel name, which includes the command so that
+// several hooks can be told apart
+func (n *Notifier) Name() string {
+	return "exec:" + n.Command
+}
+
+// Notify runs the command. A non-zero exit or a timeout is reported as an
+// error, so the hook is run again on the next poll.
+func (n *Notifier) Notify(change notifications.Change) error {
+	e := event{
+		Package:   change.PackageNumber,
+		Type:      change.Current.Data[0].Type,
+		Event:     string(change.Type()),
+		Status:    string(status.Of(change.Current)),
+		FirstSeen: change.Diff == nil,
+		NewEvents: change.Movements(),
+		Timeline:  change.Current.Data[0].Log,
+	}
+	e.NewEventsCount = len(e.NewEvents)
+	e.LastEvent, _ = change.Current.LastMovement()
+	stdin, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return n.run(change.PackageNumber, stdin,
+		"GOCAFIER_NUMBER="+e.Package,
+		"GOCAFIER_TYPE="+e.Type,
+		"GOCAFIER_EVENT="+e.Event,
+		"GOCAFIER_STATUS="+e.Status,
+		"GOCAFIER_FIRST_SEEN="+strconv.FormatBool(e.FirstSeen),
+		"GOCAFIER_NEW_EVENTS="+strconv.Itoa(e.NewEventsCount),
+		"GOCAFIER_LAST_DATE="+e.LastEvent.Date,
+		"GOCAFIER_LAST_DESCRIPTION="+e.LastEvent.Description,
+	)
+}
+
+// NotifyDigest runs the command with the digest as JSON on stdin and
+// GOCAFIER_EVENT set to "digest"
+func (n *Notifier) NotifyDigest(d notifications.Digest) error {
+	payload := digest{Event: "digest", Since: d.Since, Until: d.Until}
+	for _, entry := range d.Moved {
+		payload.Moved = append(payload.Moved, newDigestPackage(entry))
+	}
+	for _, entry := range d.Idle {
+		payload.Idle = append(payload.Idle, newDigestPackage(entry))
+	}
+	stdin, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return n.run("digest", stdin, "GOCAFIER_EVENT=digest")
+}
+
+// run executes the command with the given stdin and extra environment
+func (n *Notifier) run(label string, stdin []byte, env ...string) error {
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.Command, n.Args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Env = append(os.Environ(), env...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	killGroup(cmd)
+	cmd.WaitDelay = waitDelay
+
+	err := cmd.Run()
+	logOutput(label, n.Command, output.Bytes())
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %s", n.Command, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %s", n.Command, err)
+	}
+	log.LogPackage(label, i18n.Tr("cli.hook_completed", n.Command))
+	return nil
+}
+
+func newDigestPackage(entry notifications.DigestEntry) digestPackage {
+	p := digestPackage{
+		Package:   entry.PackageNumber,
+		Status:    string(entry.Status()),
+		NewEvents: entry.Movements,
+	}
+	p.LastEvent, _ = entry.Current.LastMovement()
+	return p
+}
+
+func logOutput(packageNumber string, command string, output []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		log.LogPackage(packageNumber, fmt.Sprintf("%s: %s", command, scanner.Text()))
+	}
+}
@@ -0,0 +1,146 @@
+//go:build unix
+
+package hook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/notifications"
+)
+
+// stub writes a shell script that saves its stdin and environment to dir
+func stub(t *testing.T, dir string, body string) string {
+	path := filepath.Join(dir, "hook.sh")
+	script := "#!/bin/sh\ncat > " + filepath.Join(dir, "stdin") + "\nenv > " + filepath.Join(dir, "env") + "\n" + body + "\n"
+	if err := ioutil.WriteFile(path, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gocafier-hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func fixtureChange(t *testing.T) notifications.Change {
+	var current caching.OcaPackageDetail
+	fixture := `{"data":[{"type":"paquetes","code":"123123123123","log":[
+		{"date":"01/01/2016 10:00","description":"En tránsito"},
+		{"date":"02/01/2016 09:00","description":"En distribución"}]}]}`
+	if err := json.Unmarshal([]byte(fixture), &current); err != nil {
+		t.Fatal(err)
+	}
+	return notifications.Change{PackageNumber: "123123123123", Current: current, Diff: current.Data[0].Log[1:]}
+}
+
+// environment reads the variables the stub saved
+func environment(t *testing.T, dir string) map[string]string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+	return env
+}
+
+func TestNotifyRunsCommand(t *testing.T) {
+	dir := tempDir(t)
+	n := &Notifier{Command: stub(t, dir, "")}
+	change := fixtureChange(t)
+	change.Event = notifications.EventStuck
+	if err := n.Notify(change); err != nil {
+		t.Fatal(err)
+	}
+
+	var got event
+	data, err := ioutil.ReadFile(filepath.Join(dir, "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("stdin is not JSON: %s", err)
+	}
+	if got.Package != "123123123123" || got.Type != "paquetes" || got.Event != "stuck" || got.Status != "out_for_delivery" {
+		t.Errorf("stdin = %+v", got)
+	}
+	if got.NewEventsCount != 1 || got.LastEvent.Description != "En distribución" || len(got.Timeline) != 2 {
+		t.Errorf("stdin movements = %+v", got)
+	}
+
+	env := environment(t, dir)
+	want := map[string]string{
+		"GOCAFIER_NUMBER":           "123123123123",
+		"GOCAFIER_TYPE":             "paquetes",
+		"GOCAFIER_EVENT":            "stuck",
+		"GOCAFIER_STATUS":           "out_for_delivery",
+		"GOCAFIER_FIRST_SEEN":       "false",
+		"GOCAFIER_NEW_EVENTS":       "1",
+		"GOCAFIER_LAST_DATE":        "02/01/2016 09:00",
+		"GOCAFIER_LAST_DESCRIPTION": "En distribución",
+	}
+	for name, value := range want {
+		if env[name] != value {
+			t.Errorf("%s = %q, want %q", name, env[name], value)
+		}
+	}
+}
+
+func TestNotifyDigest(t *testing.T) {
+	dir := tempDir(t)
+	n := &Notifier{Command: stub(t, dir, "")}
+	change := fixtureChange(t)
+	d := notifications.Digest{Idle: []notifications.DigestEntry{{PackageNumber: "123123123123", Current: change.Current}}}
+	if err := n.NotifyDigest(d); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "stdin"))
+	var got digest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("stdin is not JSON: %s", err)
+	}
+	if got.Event != "digest" || len(got.Idle) != 1 || got.Idle[0].Package != "123123123123" {
+		t.Errorf("stdin = %+v", got)
+	}
+	if env := environment(t, dir); env["GOCAFIER_EVENT"] != "digest" {
+		t.Errorf("GOCAFIER_EVENT = %q, want digest", env["GOCAFIER_EVENT"])
+	}
+}
+
+func TestNotifyFails(t *testing.T) {
+	dir := tempDir(t)
+	n := &Notifier{Command: stub(t, dir, "exit 3")}
+	if err := n.Notify(fixtureChange(t)); err == nil {
+		t.Error("a command that exits with 3 returned no error")
+	}
+}
+
+func TestNotifyTimeout(t *testing.T) {
+	dir := tempDir(t)
+	// The child keeps running in the background, holding the output open
+	n := &Notifier{Command: stub(t, dir, "sleep 30 &\nsleep 30"), Timeout: 200 * time.Millisecond}
+	start := time.Now()
+	err := n.Notify(fixtureChange(t))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > waitDelay {
+		t.Errorf("the command took %s, its process group was not killed", elapsed)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package hook
+
+import "os/exec"
+
+// killGroup does nothing without process groups. The timeout only kills the
+// command, and waitDelay stops waiting for its children
+func killGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,374 @@
+package i18n
+
+var catalogs = map[string]map[string]string{
+	SpanishArgentina: {
+		"cli.polling":            "Consultando cada %s",
+		"cli.interrupted":        "Interrumpido por el sistema operativo, saliendo.",
+		"cli.sigterm":            "Interrumpido por SIGTERM, saliendo.",
+		"cli.new_package":        "El paquete no está en el cache, guardando los datos iniciales.",
+		"cli.no_change":          "Sin cambios.",
+		"cli.not_found":          "No se encontró en el servidor",
+		"cli.retrying":           "Reintentando las notificaciones por %s",
+		"cli.listening":          "Escuchando en %s",
+		"cli.checking_type":      "Buscando en el tipo '%s'",
+		"cli.found_type":         "Encontrado en el tipo '%s'",
+		"cli.change_detected":    "Cambio detectado.",
+		"cli.retry_later":        "Las notificaciones por %s se van a reintentar en la próxima consulta.",
+		"cli.digest_queued":      "Agregado al resumen de %s",
+		"cli.digest_sent":        "Resumen enviado por %s",
+		"cli.test_ok":            "%s: OK",
+		"cli.test_failed":        "%s: ERROR: %v",
+		"cli.test_no_recipients": "%s: no se envió nada, no hay destinatarios",
+		"cli.stuck":              "Sin movimientos hace %d días hábiles, enviando el aviso.",
+		"cli.stuck_reminder":     "Sigue sin movimientos después de %d días hábiles, enviando el recordatorio.",
+		"cli.sla_warning":        "El plazo de entrega vence en %d días hábiles, enviando el aviso.",
+		"cli.sla_breach":         "Se venció el plazo de entrega de %d días hábiles, enviando la alerta.",
+		"cli.pickup_reminder":    "Sigue esperando en la sucursal hasta el %s, enviando el recordatorio.",
+		"cli.exception_flagged":  "Excepción: %s. Queda marcado hasta confirmarlo con 'gocafier ack %s'.",
+		"cli.ack":                "%s: confirmado",
+		"cli.ack_missing":        "%s: no tiene excepciones pendientes",
+		"cli.exceptions_none":    "No hay excepciones pendientes.",
+		"cli.rule_matched":       "Regla %s aplicada",
+		"cli.rule_archived":      "Archivado por una regla: ya no se consulta",
+		"cli.unarchive":          "%s: desarchivado",
+		"cli.unarchive_missing":  "%s: no estaba archivado",
+		"cli.edited":             "%s: actualizado",
+		"cli.muted_skip":         "Silenciado: no se envían notificaciones",
+		"cli.muted_until":        "%s: silenciado hasta el %s",
+		"cli.muted_forever":      "%s: silenciado hasta 'gocafier unmute'",
+		"cli.unmuted":            "%s: ya no está silenciado",
+		"cli.unmute_missing":     "%s: no estaba silenciado",
+		"cli.sending":            "Enviando la notificación...",
+		"cli.sent":               "Notificación enviada",
+		"cli.no_recipients":      "No quedan destinatarios de email para este cambio",
+		"cli.held":               "Se retiene la notificación para %s: %s",
+		"cli.every_channel":      "todos los canales",
+		"cli.reason_rate_limit":  "límite de envíos",
+		"cli.reason_quiet_hours": "horario de silencio",
+		"cli.held_muted":         "Se descarta la notificación retenida de un paquete silenciado",
+		"cli.held_unknown":       "Se descarta la notificación retenida para el canal desconocido %s",
+		"cli.retry_muted":        "Se descartan los reintentos de un paquete silenciado",
+		"cli.retry_unknown":      "Se descarta el reintento para el canal desconocido %s",
+		"cli.digest_sent_to":     "Resumen enviado a %s",
+		"cli.relays_unhealthy":   "Todos los servidores SMTP están marcados como caídos, probando con todos",
+		"cli.relay_delivered":    "Mensaje a %s entregado por el servidor %s",
+		"cli.dry_run":            "Simulación: notificación por %s guardada en %s",
+		"cli.mqtt_published":     "Estado publicado por MQTT en %s",
+		"cli.push_sent":          "Notificación push enviada por %s con prioridad %d",
+		"cli.slack_sent":         "Notificación de Slack enviada a %s",
+		"cli.slack_digest_sent":  "Resumen de Slack enviado a %s",
+		"cli.slack_tracked":      "Seguido desde Slack por %s",
+		"cli.slack_untracked":    "Dejado de seguir desde Slack por %s",
+		"cli.link_muted":         "Silenciado para %s desde un link del email (%s)",
+		"cli.hook_completed":     "Script %s terminado",
+		"cli.starting":           "Iniciando gocafier %s",
+		"cli.loading_config":     "Leyendo la configuración de %s",
+		"cli.cache_file":         "Usando el cache %s",
+		"cli.loading_template":   "Leyendo el template de email de %s",
+		"cli.legacy_template":    "Usando %s del directorio actual. Está en desuso: indicá su ruta en email.templates.html",
+		"cli.smtp_connecting":    "Conectando al servidor SMTP %s (tls: %s)",
+
+		"error.read_mutes":         "No se pudieron leer los silenciados",
+		"error.save_thread":        "No se pudo guardar el hilo del email",
+		"error.relay_failed":       "Falló el servidor %s, queda marcado como caído por %s",
+		"error.digest_read":        "No se pudo leer el resumen de %s",
+		"error.digest_start":       "No se pudo iniciar el resumen de %s",
+		"error.digest_build":       "No se pudo armar el resumen de %s",
+		"error.digest_failed":      "Falló el resumen de %s, se va a reintentar en la próxima consulta",
+		"error.digest_reset":       "No se pudo reiniciar el resumen de %s",
+		"error.digest_not_retried": "El resumen de %s no se reintenta",
+		"error.read_held":          "No se pudieron leer las notificaciones retenidas",
+		"error.hold":               "No se pudo retener la notificación",
+		"error.read_package":       "No se pudo leer el paquete",
+		"error.release_held":       "No se pudo liberar la notificación retenida",
+		"error.save_pending":       "No se pudieron guardar las notificaciones pendientes",
+		"error.held_failed":        "Falló la notificación retenida por %s, se va a reintentar en la próxima consulta",
+		"error.read_info":          "No se pudieron leer los datos del paquete",
+		"error.notify_failed":      "Falló la notificación por %s",
+		"error.close_cycle":        "No se pudo cerrar %s al terminar la consulta",
+		"error.slack_rejected":     "Pedido de Slack rechazado",
+		"error.slack_subscribe":    "No se pudo guardar la suscripción de Slack",
+		"error.slack_unsubscribe":  "No se pudo borrar la suscripción de Slack",
+		"error.slack_list":         "No se pudieron listar las suscripciones de Slack",
+		"error.slack_not_retried":  "La notificación de Slack no se reintenta",
+		"error.link_rejected":      "Link de email rechazado",
+		"error.link_mute":          "No se pudo guardar el silenciado de un link de email",
+
+		"status.unknown":          "Desconocido",
+		"status.admitted":         "Admitido",
+		"status.in_transit":       "En tránsito",
+		"status.at_branch":        "En sucursal",
+		"status.out_for_delivery": "En distribución",
+		"status.delivered":        "Entregado",
+		"status.delivery_failed":  "Entrega fallida",
+		"status.returned":         "Devuelto al remitente",
+
+		"email.label":            "Paquete OCA %s",
+		"email.status":           "Estado: %s",
+		"email.new":              "nuevo",
+		"email.new_legend":       "(*) movimientos nuevos",
+		"email.branch":           "Sucursal de retiro",
+		"email.pickup_until":     "Podés retirarlo hasta el %s.",
+		"email.exception":        "Atención: el envío tuvo un problema y puede requerir que hagas algo.",
+		"email.exception_legend": "(!) problemas en la entrega",
+		"email.owner":            "Responsable: %s",
+		"email.expected":         "Entrega estimada: %s",
+		"email.mute":             "Silenciar este envío por unos días",
+		"email.unsubscribe":      "Dejar de recibir novedades de este envío",
+
+		"links.mute_confirm":        "¿Silenciar las novedades del envío %s hasta el %s?",
+		"links.unsubscribe_confirm": "¿Dejar de recibir las novedades del envío %s?",
+		"links.mute":                "Silenciar",
+		"links.unsubscribe":         "Desuscribirme",
+		"links.muted":               "Listo: no vas a recibir novedades del envío %s hasta el %s.",
+		"links.unsubscribed":        "Listo: no vas a recibir más novedades del envío %s.",
+
+		"slack.usage":          "Uso: `/gocafier track|untrack|status <número>` o `/gocafier list`",
+		"slack.tracking":       "Siguiendo el paquete %s. Te vamos a mandar las novedades.",
+		"slack.track_failed":   "No se pudo seguir el paquete, probá de nuevo.",
+		"slack.untracked":      "Ya no seguís el paquete %s.",
+		"slack.untrack_failed": "No se pudo dejar de seguir el paquete, probá de nuevo.",
+		"slack.list_title":     "Tus paquetes:",
+		"slack.list_empty":     "No estás siguiendo ningún paquete.",
+		"slack.list_failed":    "No se pudieron listar tus paquetes, probá de nuevo.",
+		"slack.no_movements":   "todavía sin movimientos",
+		"slack.package":        "Paquete %s",
+		"slack.not_found":      "El paquete %s todavía no aparece en OCA.",
+		"slack.read_failed":    "No se pudo leer el paquete, probá de nuevo.",
+
+		"headline.first_seen":       "Empezamos a seguir el envío %s. Estos son sus movimientos hasta ahora.",
+		"headline.new_movement":     "Hay un update del envío de referencia.",
+		"headline.out_for_delivery": "El envío salió a distribución. Debería llegar en el día.",
+		"headline.ready_for_pickup": "El envío está listo para retirar en sucursal.",
+		"headline.delivered":        "El envío fue entregado.",
+		"headline.stuck":            "El envío no registra movimientos desde %s.",
+		"headline.sla_warning":      "El envío debería entregarse a más tardar el %s.",
+		"headline.sla_breach":       "El envío no se entregó dentro del plazo comprometido, que vencía el %s.",
+		"headline.pickup_reminder":  "Recordá que el envío te espera en la sucursal.",
+		"headline.error":            "Hubo un problema con el envío: %s",
+
+		"subject.first_seen":       "%s: seguimiento iniciado",
+		"subject.new_movement":     "%s: %s",
+		"subject.out_for_delivery": "%s está en distribución",
+		"subject.ready_for_pickup": "%s está listo para retirar",
+		"subject.delivered":        "%s fue entregado",
+		"subject.stuck":            "%s no registra movimientos",
+		"subject.sla_warning":      "%s está por vencer su plazo de entrega",
+		"subject.sla_breach":       "%s no se entregó a tiempo",
+		"subject.pickup_reminder":  "Recordatorio: %s está para retirar",
+		"subject.error":            "Problema con %s: %s",
+		"subject.digest":           "Resumen de tus envíos OCA",
+
+		"digest.title":       "Resumen de envíos",
+		"digest.period":      "Desde el %s hasta el %s",
+		"digest.moved":       "Envíos con movimientos",
+		"digest.idle":        "Envíos sin movimientos",
+		"digest.last_update": "Último movimiento: %s",
+		"digest.none":        "Ninguno",
+
+		"list.package":  "Paquete",
+		"list.label":    "Nombre",
+		"list.status":   "Estado",
+		"list.owner":    "Responsable",
+		"list.tags":     "Etiquetas",
+		"list.expected": "Entrega estimada",
+		"list.archived": "(archivado)",
+		"list.muted":    "(silenciado)",
+
+		"sla.package":     "Paquete",
+		"sla.type":        "Tipo",
+		"sla.start":       "Inicio",
+		"sla.deadline":    "Vencimiento",
+		"sla.days":        "Días hábiles",
+		"sla.result":      "Resultado",
+		"sla.on_time":     "A tiempo",
+		"sla.late":        "Tarde",
+		"sla.in_progress": "En curso",
+		"sla.summary":     "A tiempo: %d, tarde: %d, en curso: %d",
+	},
+	English: {
+		"cli.polling":            "Start polling each %s",
+		"cli.interrupted":        "Interrupted by OS, exiting.",
+		"cli.sigterm":            "Interrupted by SIGTERM, exiting.",
+		"cli.new_package":        "Package does not exist in cache, saving initial data.",
+		"cli.no_change":          "No change.",
+		"cli.not_found":          "Not found in server",
+		"cli.retrying":           "Retrying notifications through %s",
+		"cli.listening":          "Listening on %s",
+		"cli.checking_type":      "Checking in type '%s'",
+		"cli.found_type":         "Found in type '%s'",
+		"cli.change_detected":    "Change detected.",
+		"cli.retry_later":        "Notifications through %s will be retried on next poll.",
+		"cli.digest_queued":      "Added to the %s digest",
+		"cli.digest_sent":        "Digest sent through %s",
+		"cli.test_ok":            "%s: OK",
+		"cli.test_failed":        "%s: ERROR: %v",
+		"cli.test_no_recipients": "%s: nothing delivered, no recipients",
+		"cli.stuck":              "No movement for %d business days, sending a stuck alert.",
+		"cli.stuck_reminder":     "Still no movement after %d business days, sending a reminder.",
+		"cli.sla_warning":        "The delivery deadline is due in %d business days, sending a warning.",
+		"cli.sla_breach":         "The delivery deadline of %d business days was missed, sending an alert.",
+		"cli.pickup_reminder":    "Still waiting at the branch until %s, sending a reminder.",
+		"cli.exception_flagged":  "Exception: %s. Flagged until acknowledged with 'gocafier ack %s'.",
+		"cli.ack":                "%s: acknowledged",
+		"cli.ack_missing":        "%s: no pending exceptions",
+		"cli.exceptions_none":    "No pending exceptions.",
+		"cli.rule_matched":       "Rule %s applied",
+		"cli.rule_archived":      "Archived by a rule: no longer polled",
+		"cli.unarchive":          "%s: unarchived",
+		"cli.unarchive_missing":  "%s: was not archived",
+		"cli.edited":             "%s: updated",
+		"cli.muted_skip":         "Muted: no notifications are sent",
+		"cli.muted_until":        "%s: muted until %s",
+		"cli.muted_forever":      "%s: muted until 'gocafier unmute'",
+		"cli.unmuted":            "%s: no longer muted",
+		"cli.unmute_missing":     "%s: was not muted",
+		"cli.sending":            "Sending notification...",
+		"cli.sent":               "Notification sent",
+		"cli.no_recipients":      "No email recipients left for this change",
+		"cli.held":               "Holding the notification for %s: %s",
+		"cli.every_channel":      "every channel",
+		"cli.reason_rate_limit":  "rate limit",
+		"cli.reason_quiet_hours": "quiet hours",
+		"cli.held_muted":         "Dropping held notification of a muted package",
+		"cli.held_unknown":       "Dropping held notification for unknown channel %s",
+		"cli.retry_muted":        "Dropping retries of a muted package",
+		"cli.retry_unknown":      "Dropping retry for unknown channel %s",
+		"cli.digest_sent_to":     "Digest sent to %s",
+		"cli.relays_unhealthy":   "Every SMTP relay is marked as unhealthy, trying all of them",
+		"cli.relay_delivered":    "Message to %s delivered through relay %s",
+		"cli.dry_run":            "Dry run: %s notification written to %s",
+		"cli.mqtt_published":     "MQTT state published to %s",
+		"cli.push_sent":          "Push notification sent through %s with priority %d",
+		"cli.slack_sent":         "Slack notification sent to %s",
+		"cli.slack_digest_sent":  "Slack digest sent to %s",
+		"cli.slack_tracked":      "Tracked from Slack by %s",
+		"cli.slack_untracked":    "Untracked from Slack by %s",
+		"cli.link_muted":         "Muted for %s from an email link (%s)",
+		"cli.hook_completed":     "Hook %s completed",
+		"cli.starting":           "Starting gocafier %s",
+		"cli.loading_config":     "Loading config from %s",
+		"cli.cache_file":         "Setting cache file to %s",
+		"cli.loading_template":   "Loading email template from %s",
+		"cli.legacy_template":    "Using %s from the working directory. It is deprecated: set its path in email.templates.html",
+		"cli.smtp_connecting":    "Connecting to SMTP server %s (tls: %s)",
+
+		"error.read_mutes":         "Could not read the mutes",
+		"error.save_thread":        "Could not save the email thread",
+		"error.relay_failed":       "Relay %s failed, marking it unhealthy for %s",
+		"error.digest_read":        "Could not read the %s digest",
+		"error.digest_start":       "Could not start the %s digest",
+		"error.digest_build":       "Could not build the %s digest",
+		"error.digest_failed":      "%s digest failed, it will be retried on next poll",
+		"error.digest_reset":       "Could not reset the %s digest",
+		"error.digest_not_retried": "The %s digest is not retried",
+		"error.read_held":          "Could not read the held notifications",
+		"error.hold":               "Could not hold the notification",
+		"error.read_package":       "Could not read the package",
+		"error.release_held":       "Could not release the held notification",
+		"error.save_pending":       "Could not save the pending notifications",
+		"error.held_failed":        "Held %s notification failed, it will be retried on next poll",
+		"error.read_info":          "Could not read the package metadata",
+		"error.notify_failed":      "%s notification failed",
+		"error.close_cycle":        "Could not close %s at the end of the cycle",
+		"error.slack_rejected":     "Rejected Slack request",
+		"error.slack_subscribe":    "Could not save Slack subscription",
+		"error.slack_unsubscribe":  "Could not remove Slack subscription",
+		"error.slack_list":         "Could not list Slack subscriptions",
+		"error.slack_not_retried":  "Slack notification not retried",
+		"error.link_rejected":      "Rejected email link",
+		"error.link_mute":          "Could not save the mute of an email link",
+
+		"status.unknown":          "Unknown",
+		"status.admitted":         "Admitted",
+		"status.in_transit":       "In transit",
+		"status.at_branch":        "At branch",
+		"status.out_for_delivery": "Out for delivery",
+		"status.delivered":        "Delivered",
+		"status.delivery_failed":  "Delivery failed",
+		"status.returned":         "Returned to sender",
+
+		"email.label":            "OCA package %s",
+		"email.status":           "Status: %s",
+		"email.new":              "new",
+		"email.new_legend":       "(*) new movements",
+		"email.branch":           "Pickup branch",
+		"email.pickup_until":     "You can pick it up until %s.",
+		"email.exception":        "Attention: the shipment had a problem and may need you to act.",
+		"email.exception_legend": "(!) delivery problems",
+		"email.owner":            "Owner: %s",
+		"email.expected":         "Expected delivery: %s",
+		"email.mute":             "Mute this shipment for a few days",
+		"email.unsubscribe":      "Stop getting updates about this shipment",
+
+		"links.mute_confirm":        "Mute the updates about shipment %s until %s?",
+		"links.unsubscribe_confirm": "Stop getting updates about shipment %s?",
+		"links.mute":                "Mute",
+		"links.unsubscribe":         "Unsubscribe",
+		"links.muted":               "Done: you will not get updates about shipment %s until %s.",
+		"links.unsubscribed":        "Done: you will not get any more updates about shipment %s.",
+
+		"slack.usage":          "Usage: `/gocafier track|untrack|status <number>` or `/gocafier list`",
+		"slack.tracking":       "Tracking package %s. Updates will be sent to you.",
+		"slack.track_failed":   "Could not track the package, please try again.",
+		"slack.untracked":      "Package %s is no longer tracked for you.",
+		"slack.untrack_failed": "Could not untrack the package, please try again.",
+		"slack.list_title":     "Your packages:",
+		"slack.list_empty":     "You are not tracking any package.",
+		"slack.list_failed":    "Could not list your packages, please try again.",
+		"slack.no_movements":   "no movements yet",
+		"slack.package":        "Package %s",
+		"slack.not_found":      "Package %s has not been found in OCA yet.",
+		"slack.read_failed":    "Could not read the package, please try again.",
+
+		"headline.first_seen":       "We started tracking shipment %s. These are its movements so far.",
+		"headline.new_movement":     "There is an update on this shipment.",
+		"headline.out_for_delivery": "The shipment is out for delivery. It should arrive today.",
+		"headline.ready_for_pickup": "The shipment is ready for pickup at the branch.",
+		"headline.delivered":        "The shipment was delivered.",
+		"headline.stuck":            "The shipment has not moved since %s.",
+		"headline.sla_warning":      "The shipment should be delivered by %s.",
+		"headline.sla_breach":       "The shipment was not delivered within the promised time, which ended on %s.",
+		"headline.pickup_reminder":  "Remember that the shipment is waiting for you at the branch.",
+		"headline.error":            "There was a problem with the shipment: %s",
+
+		"subject.first_seen":       "%s: tracking started",
+		"subject.new_movement":     "%s: %s",
+		"subject.out_for_delivery": "%s is out for delivery",
+		"subject.ready_for_pickup": "%s is ready for pickup",
+		"subject.delivered":        "%s was delivered",
+		"subject.stuck":            "%s has not moved",
+		"subject.sla_warning":      "%s is about to miss its delivery date",
+		"subject.sla_breach":       "%s was not delivered on time",
+		"subject.pickup_reminder":  "Reminder: %s is ready for pickup",
+		"subject.error":            "Problem with %s: %s",
+		"subject.digest":           "Your OCA shipments summary",
+
+		"digest.title":       "Shipments summary",
+		"digest.period":      "From %s to %s",
+		"digest.moved":       "Shipments with movements",
+		"digest.idle":        "Shipments without movements",
+		"digest.last_update": "Last movement: %s",
+		"digest.none":        "None",
+
+		"list.package":  "Package",
+		"list.label":    "Label",
+		"list.status":   "Status",
+		"list.owner":    "Owner",
+		"list.tags":     "Tags",
+		"list.expected": "Expected delivery",
+		"list.archived": "(archived)",
+		"list.muted":    "(muted)",
+
+		"sla.package":     "Package",
+		"sla.type":        "Type",
+		"sla.start":       "Start",
+		"sla.deadline":    "Deadline",
+		"sla.days":        "Business days",
+		"sla.result":      "Result",
+		"sla.on_time":     "On time",
+		"sla.late":        "Late",
+		"sla.in_progress": "In progress",
+		"sla.summary":     "On time: %d, late: %d, in progress: %d",
+	},
+}
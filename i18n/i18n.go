@@ -0,0 +1,110 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Supported locales
+const (
+	SpanishArgentina = "es-AR"
+	English          = "en"
+	// DefaultLocale is used when no locale is configured and for missing translations
+	DefaultLocale = SpanishArgentina
+)
+
+// current is the locale of the console. It stays in English, as before the
+// catalogs existed, until a locale is configured.
+var current = English
+
+// dateLayouts are the date formats of each locale
+var dateLayouts = map[string]string{
+	SpanishArgentina: "02/01/2006 15:04",
+	English:          "Jan 2, 2006 3:04 PM",
+}
+
+// dayLayouts are the formats of each locale for dates without time
+var dayLayouts = map[string]string{
+	SpanishArgentina: "02/01/2006",
+	English:          "Jan 2, 2006",
+}
+
+// SetLocale sets the locale used by Tr. An empty locale keeps the console in English.
+func SetLocale(locale string) {
+	if locale == "" {
+		current = English
+		return
+	}
+	current = Normalize(locale)
+}
+
+// Locale returns the locale used by Tr
+func Locale() string {
+	return current
+}
+
+// Normalize returns the supported locale that best matches the given one,
+// so "es", "es_AR.UTF-8" and "en-US" are all accepted. Unknown locales map
+// to the default one.
+func Normalize(locale string) string {
+	locale = strings.Replace(strings.SplitN(locale, ".", 2)[0], "_", "-", -1)
+	for supported := range catalogs {
+		if strings.EqualFold(locale, supported) {
+			return supported
+		}
+	}
+	language := strings.ToLower(strings.SplitN(locale, "-", 2)[0])
+	switch language {
+	case "es":
+		return SpanishArgentina
+	case "en":
+		return English
+	}
+	return DefaultLocale
+}
+
+// Locales returns the supported locales
+func Locales() []string {
+	return []string{SpanishArgentina, English}
+}
+
+// IsSupported tells whether there is a catalog for the locale
+func IsSupported(locale string) bool {
+	language := strings.ToLower(strings.SplitN(strings.Replace(locale, "_", "-", -1), "-", 2)[0])
+	return language == "es" || language == "en"
+}
+
+// T returns the message of the catalog of a locale, formatted with args.
+// Missing messages fall back to the default locale and then to the key.
+func T(locale string, key string, args ...interface{}) string {
+	message, ok := catalogs[Normalize(locale)][key]
+	if !ok {
+		message, ok = catalogs[DefaultLocale][key]
+	}
+	if !ok {
+		message = key
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// Tr returns a message in the locale set with SetLocale
+func Tr(key string, args ...interface{}) string {
+	return T(current, key, args...)
+}
+
+// FormatTime formats a time for a locale, in the given timezone
+func FormatTime(locale string, t time.Time, location *time.Location) string {
+	if location != nil {
+		t = t.In(location)
+	}
+	return t.Format(dateLayouts[Normalize(locale)])
+}
+
+// FormatDate formats the day of a time for a locale, without the time
+func FormatDate(locale string, t time.Time) string {
+	return t.Format(dayLayouts[Normalize(locale)])
+}
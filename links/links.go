@@ -0,0 +1,149 @@
+package links
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+)
+
+// Actions of the links
+const (
+	Mute        = "mute"
+	Unsubscribe = "unsubscribe"
+)
+
+// Link asks to silence a package for an email address
+type Link struct {
+	Action    string
+	Package   string
+	Recipient string
+	// For is how long a mute link silences the package
+	For time.Duration
+}
+
+// URL returns the signed address of the link on the server at baseURL
+func (l Link) URL(baseURL string, secret string) string {
+	query := url.Values{"p": {l.Package}, "r": {l.Recipient}, "s": {l.signature(secret)}}
+	if l.Action == Mute {
+		query.Set("for", strconv.FormatInt(int64(l.For/time.Second), 10))
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + l.Action + "?" + query.Encode()
+}
+
+func (l Link) signature(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", l.Action, l.Package, strings.ToLower(l.Recipient), int64(l.For/time.Second))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Handler serves the links at /mute and /unsubscribe. A GET only asks for
+// confirmation, so the link scanners of the mail servers do not mute
+// anything, and a POST applies the link, as the one-click unsubscribe of
+// RFC 8058 expects.
+type Handler struct {
+	Secret string
+	// Now returns the current time
+	Now func() time.Time
+}
+
+// NewHandler returns a handler that verifies the links with the secret
+func NewHandler(secret string) *Handler {
+	return &Handler{Secret: secret, Now: time.Now}
+}
+
+var page = htmltemplate.Must(htmltemplate.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Gocafier</title></head>
+<body>
+<p>{{.Message}}</p>
+{{ if .Button }}<form method="post"><button type="submit">{{.Button}}</button></form>{{ end }}
+</body>
+</html>
+`))
+
+type pageData struct {
+	Message string
+	Button  string
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	link, err := h.parse(r)
+	if err != nil {
+		log.LogError(i18n.Tr("error.link_rejected"), err)
+		http.Error(w, "invalid link", http.StatusBadRequest)
+		return
+	}
+	locale := settings.LocaleFor(link.Recipient)
+	var until time.Time
+	if link.Action == Mute {
+		until = h.Now().Add(link.For)
+	}
+	when := i18n.FormatTime(locale, until, settings.Location())
+
+	data := pageData{}
+	if r.Method == "GET" {
+		if link.Action == Mute {
+			data.Message = i18n.T(locale, "links.mute_confirm", link.Package, when)
+		} else {
+			data.Message = i18n.T(locale, "links.unsubscribe_confirm", link.Package)
+		}
+		data.Button = i18n.T(locale, "links."+link.Action)
+	} else {
+		if err := caching.SetMute(link.Package, link.Recipient, until); err != nil {
+			log.LogError(i18n.Tr("error.link_mute"), err)
+			http.Error(w, "could not save the mute, please try again", http.StatusInternalServerError)
+			return
+		}
+		log.LogPackage(link.Package, i18n.Tr("cli.link_muted", link.Recipient, link.Action))
+		if link.Action == Mute {
+			data.Message = i18n.T(locale, "links.muted", link.Package, when)
+		} else {
+			data.Message = i18n.T(locale, "links.unsubscribed", link.Package)
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page.Execute(w, data)
+}
+
+// parse returns the link of a request, after checking its signature
+func (h *Handler) parse(r *http.Request) (Link, error) {
+	query := r.URL.Query()
+	link := Link{
+		Action:    strings.TrimPrefix(r.URL.Path, "/"),
+		Package:   query.Get("p"),
+		Recipient: query.Get("r"),
+	}
+	if link.Action != Mute && link.Action != Unsubscribe {
+		return link, fmt.Errorf("unknown action %q", link.Action)
+	}
+	if link.Package == "" || link.Recipient == "" {
+		return link, fmt.Errorf("missing package or recipient")
+	}
+	if link.Action == Mute {
+		seconds, err := strconv.ParseInt(query.Get("for"), 10, 64)
+		if err != nil || seconds <= 0 {
+			return link, fmt.Errorf("invalid duration %q", query.Get("for"))
+		}
+		link.For = time.Duration(seconds) * time.Second
+	}
+	if !hmac.Equal([]byte(link.signature(h.Secret)), []byte(query.Get("s"))) {
+		return link, fmt.Errorf("signature mismatch")
+	}
+	return link, nil
+}
@@ -2,45 +2,210 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/eljuanchosf/gocafier/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v2"
 	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/calendar"
+	"github.com/eljuanchosf/gocafier/dkim"
+	"github.com/eljuanchosf/gocafier/hook"
+	"github.com/eljuanchosf/gocafier/i18n"
+	"github.com/eljuanchosf/gocafier/links"
 	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/mqtt"
 	"github.com/eljuanchosf/gocafier/notifications"
 	"github.com/eljuanchosf/gocafier/ocaclient"
+	"github.com/eljuanchosf/gocafier/push"
+	"github.com/eljuanchosf/gocafier/rules"
 	"github.com/eljuanchosf/gocafier/settings"
+	"github.com/eljuanchosf/gocafier/slack"
+	"github.com/eljuanchosf/gocafier/status"
 )
 
 var (
-	debug        = kingpin.Flag("debug", "Enable debug mode. This disables emailing").Default("false").OverrideDefaultFromEnvar("GOCAFIER_DEBUG").Bool()
+	debug        = kingpin.Flag("debug", "Enable debug mode. Notifications are still sent; see --dry-run").Default("false").OverrideDefaultFromEnvar("GOCAFIER_DEBUG").Bool()
+	dryRun       = kingpin.Flag("dry-run", "Poll once and write the notifications instead of sending them. The cache is not updated").Default("false").OverrideDefaultFromEnvar("GOCAFIER_DRY_RUN").Bool()
+	dryRunDir    = kingpin.Flag("dry-run-dir", "Directory for the .eml and .json files of --dry-run. Stdout is used when empty").Default("").OverrideDefaultFromEnvar("GOCAFIER_DRY_RUN_DIR").String()
+	dryRunSave   = kingpin.Flag("dry-run-save-cache", "Update the cache during --dry-run, as a real poll would").Default("false").OverrideDefaultFromEnvar("GOCAFIER_DRY_RUN_SAVE_CACHE").Bool()
 	cachePath    = kingpin.Flag("cache-path", "Bolt Database path ").Default("").OverrideDefaultFromEnvar("GOCAFIER_CACHE_PATH").String()
 	tickerTime   = kingpin.Flag("ticker-time", "Poller interval in secs").Default("3600s").OverrideDefaultFromEnvar("GOCAFIER_PULL_TIME").Duration()
 	configPath   = kingpin.Flag("config-path", "Set the Path to write profiling file").Default(".").OverrideDefaultFromEnvar("GOCAFIER_PATH_PROF").String()
-	smtpUser     = kingpin.Flag("smtp-user", "Sets the SMTP username").Required().OverrideDefaultFromEnvar("GOCAFIER_SMTP_USER").String()
-	smtpPassword = kingpin.Flag("smtp-pass", "Sets the SMTP password").Required().OverrideDefaultFromEnvar("GOCAFIER_SMTP_PASSWORD").String()
+	smtpUser     = kingpin.Flag("smtp-user", "Sets the SMTP username. Not needed with the sendmail transport").Default("").OverrideDefaultFromEnvar("GOCAFIER_SMTP_USER").String()
+	smtpPassword = kingpin.Flag("smtp-pass", "Sets the SMTP password. Not needed with the sendmail transport").Default("").OverrideDefaultFromEnvar("GOCAFIER_SMTP_PASSWORD").String()
+	listenAddr   = kingpin.Flag("listen", "Address of the HTTP server, e.g. ':8080'. Disabled when empty").Default("").OverrideDefaultFromEnvar("GOCAFIER_LISTEN").String()
+	slackSecret  = kingpin.Flag("slack-signing-secret", "Slack signing secret used to verify slash commands").Default("").OverrideDefaultFromEnvar("GOCAFIER_SLACK_SIGNING_SECRET").String()
+	linkSecret   = kingpin.Flag("link-secret", "Secret that signs the mute and unsubscribe links of the emails").Default("").OverrideDefaultFromEnvar("GOCAFIER_LINK_SECRET").String()
+	slackToken   = kingpin.Flag("slack-token", "Slack bot token used to send updates").Default("").OverrideDefaultFromEnvar("GOCAFIER_SLACK_TOKEN").String()
+	mqttUser     = kingpin.Flag("mqtt-user", "Sets the MQTT username").Default("").OverrideDefaultFromEnvar("GOCAFIER_MQTT_USER").String()
+	mqttPassword = kingpin.Flag("mqtt-pass", "Sets the MQTT password").Default("").OverrideDefaultFromEnvar("GOCAFIER_MQTT_PASSWORD").String()
+	locale       = kingpin.Flag("locale", "Language of the notifications and the console output: es-AR or en. Overrides the config file").Default("").OverrideDefaultFromEnvar("GOCAFIER_LOCALE").String()
+)
+
+var (
+	runCommand        = kingpin.Command("run", "Poll the packages and send the notifications. This is the default command")
+	testNotifyCommand = kingpin.Command("test-notify", "Send a test notification through the configured channels")
+	testChannel       = testNotifyCommand.Flag("channel", "Only test this channel, e.g. email, slack or exec:<command>").Default("").String()
+	testPackage       = testNotifyCommand.Flag("package", "Package to test with. Its cached data is used when available, fixture data otherwise").Default("000000000000").String()
+	testEvent         = testNotifyCommand.Flag("event", "Event whose template is rendered").Default(string(notifications.EventNewMovement)).Enum(eventNames()...)
+	holidaysCommand   = kingpin.Command("holidays", "List the holidays used to count business days")
+	slaCommand        = kingpin.Command("sla", "Report the on-time and late shipments of the cache")
+	exceptionsCommand = kingpin.Command("exceptions", "List the packages flagged with an exception")
+	ackCommand        = kingpin.Command("ack", "Acknowledge the exceptions of some packages")
+	ackPackages       = ackCommand.Arg("package", "Packages whose exceptions are acknowledged").Required().Strings()
+	unarchiveCommand  = kingpin.Command("unarchive", "Poll again some packages archived by a rule")
+	unarchivePackages = unarchiveCommand.Arg("package", "Packages to unarchive").Required().Strings()
+	editCommand       = kingpin.Command("edit", "Set the label, notes, tags and other metadata of a package")
+	editNumber        = editCommand.Arg("package", "Package to edit").Required().String()
+	editLabel         = optionalFlag(editCommand, "label", "Name of the package in the notifications")
+	editNotes         = optionalFlag(editCommand, "notes", "Free-form notes about the package")
+	editOwner         = optionalFlag(editCommand, "owner", "Person the package belongs to")
+	editCreated       = optionalFlag(editCommand, "created", "Date the shipment was created, as YYYY-MM-DD")
+	editExpected      = optionalFlag(editCommand, "expected-delivery", "Date the package should arrive, as YYYY-MM-DD")
+	editTags          = editCommand.Flag("tag", "Add a tag. Can be repeated").Strings()
+	editUntags        = editCommand.Flag("untag", "Remove a tag. Can be repeated").Strings()
+	listCommand       = kingpin.Command("list", "List the packages with their metadata")
+	listTag           = listCommand.Flag("tag", "Only list the packages with this tag").Default("").String()
+	listOwner         = listCommand.Flag("owner", "Only list the packages of this owner").Default("").String()
+	muteCommand       = kingpin.Command("mute", "Stop the notifications of a package, which is still polled")
+	muteNumber        = muteCommand.Arg("package", "Package to mute").Required().String()
+	muteFor           = muteCommand.Flag("for", "How long, e.g. 3d or 12h. Until unmuted when empty").Default("").String()
+	muteRecipient     = muteCommand.Flag("recipient", "Only mute the emails to this address").Default("").String()
+	unmuteCommand     = kingpin.Command("unmute", "Notify a muted package again")
+	unmuteNumber      = unmuteCommand.Arg("package", "Package to unmute").Required().String()
+	unmuteRecipient   = unmuteCommand.Flag("recipient", "Only unmute the emails to this address").Default("").String()
+	holidaysYear      = holidaysCommand.Flag("year", "Year to list. Defaults to the current one").Default("0").Int()
 )
 
 var config settings.Config
-var ocaPackageTypes = []string{"paquetes", "cartas", "dni", "partidas"}
 
 const (
 	version = "1.0.0"
 )
 
 func main() {
-	log.LogStd(fmt.Sprintf("Starting gocafier %s ", version), true)
-	log.SetupLogging(*debug)
+	log.LogStd(i18n.Tr("cli.starting", version), true)
 
 	kingpin.Version(version)
-	kingpin.Parse()
+	command := kingpin.MustParse(kingpin.CommandLine.Parse(withDefaultCommand(os.Args[1:], runCommand.FullCommand())))
+	log.SetupLogging(*debug)
 	settings.LoadConfig(*configPath)
+	if *locale != "" {
+		if !i18n.IsSupported(*locale) {
+			kingpin.Fatalf("unsupported locale %q", *locale)
+		}
+		settings.Values.Locale = *locale
+	}
+	i18n.SetLocale(settings.Values.Locale)
+	if command == holidaysCommand.FullCommand() {
+		listHolidays()
+		return
+	}
 	caching.CreateBucket(*cachePath)
+	// Test notifications must not change the threads or anything else in the cache
+	caching.SetReadOnly(command == testNotifyCommand.FullCommand() || command == slaCommand.FullCommand() || command == exceptionsCommand.FullCommand() || command == listCommand.FullCommand() || (*dryRun && !*dryRunSave))
+	switch command {
+	case slaCommand.FullCommand():
+		slaReport()
+		return
+	case exceptionsCommand.FullCommand():
+		listExceptions()
+		return
+	case ackCommand.FullCommand():
+		acknowledge()
+		return
+	case unarchiveCommand.FullCommand():
+		unarchive()
+		return
+	case editCommand.FullCommand():
+		edit()
+		return
+	case listCommand.FullCommand():
+		listPackages()
+		return
+	case muteCommand.FullCommand():
+		mute()
+		return
+	case unmuteCommand.FullCommand():
+		unmute()
+		return
+	}
 
-	log.LogStd(fmt.Sprintf("Start polling each %s", *tickerTime), true)
+	if err := notifications.LoadTemplates(); err != nil {
+		panic(err)
+	}
+	sender := notifications.NewDryRunSender(*dryRunDir)
+	if !*dryRun {
+		if notifications.RequiresCredentials() && (*smtpUser == "" || *smtpPassword == "") {
+			kingpin.Fatalf("--smtp-user and --smtp-pass are required by the smtp transport")
+		}
+		var err error
+		sender, err = notifications.NewSender(*smtpUser, *smtpPassword)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if settings.Values.Links.BaseURL != "" && *linkSecret == "" {
+		kingpin.Fatalf("--link-secret is required by links.base_url")
+	}
+	notifications.SetLinkSecret(*linkSecret)
+	if dkimConfig := settings.Values.DKIM; dkimConfig.PrivateKey != "" {
+		signer, err := dkim.NewSigner(dkimConfig.Domain, dkimConfig.Selector, dkimConfig.PrivateKey, dkimConfig.Headers)
+		if err != nil {
+			panic(err)
+		}
+		sender = &dkim.Sender{Signer: signer, Next: sender}
+	}
+	notifications.Register(&notifications.EmailNotifier{Sender: sender})
+	if *slackToken != "" {
+		register(slack.NewNotifier(*slackToken))
+	}
+	if settings.Values.MQTT.Broker != "" {
+		register(newMQTTNotifier())
+	}
+	for _, server := range settings.Values.Push {
+		register(&push.Notifier{
+			Kind:     server.Kind,
+			URL:      server.URL,
+			Topic:    server.Topic,
+			Topics:   server.Topics,
+			Token:    server.Token,
+			ClickURL: server.ClickURL,
+		})
+	}
+	for _, command := range settings.Values.Exec {
+		register(&hook.Notifier{Command: command.Command, Args: command.Args, Timeout: command.Timeout})
+	}
+	if err := notifications.CheckDigest(); err != nil {
+		panic(err)
+	}
+	if err := notifications.CheckEscalation(); err != nil {
+		panic(err)
+	}
+	if err := rules.Check(); err != nil {
+		panic(err)
+	}
+
+	switch command {
+	case testNotifyCommand.FullCommand():
+		os.Exit(testNotify())
+	default:
+		if *listenAddr != "" && !*dryRun {
+			go startServer(*listenAddr)
+		}
+		poll()
+	}
+}
+
+// poll checks the packages every tick and notifies their changes
+func poll() {
+	log.LogStd(i18n.Tr("cli.polling", *tickerTime), true)
 
 	//Control signal interruptions
 	sigc := make(chan os.Signal, 1)
@@ -54,18 +219,21 @@ func main() {
 		sig := <-sigc
 		switch sig {
 		case os.Interrupt:
-			log.LogStd("Interrupted by OS, exiting.", true)
+			log.LogStd(i18n.Tr("cli.interrupted"), true)
 			caching.Close()
 			os.Exit(0)
 		case syscall.SIGTERM:
-			log.LogStd("Interrupted by SIGTERM, exiting.", true)
+			log.LogStd(i18n.Tr("cli.sigterm"), true)
 			caching.Close()
 			os.Exit(0)
 		}
 	}()
 
 	for {
-		for _, packageNumber := range settings.Values.Packages {
+		retryPendingNotifications()
+		notifications.FlushHeld(time.Now())
+		packages := packagesToPoll()
+		for _, packageNumber := range packages {
 			pastData, err := caching.GetPackage(packageNumber)
 			if err != nil {
 				panic(err)
@@ -76,31 +244,472 @@ func main() {
 			if packageFound {
 				currentData.Data[0].Type = packageType
 				if pastData == nil {
-					log.LogPackage(packageNumber, "Package does not exist in cache, saving initial data.")
+					log.LogPackage(packageNumber, i18n.Tr("cli.new_package"))
 					changeDetected(packageNumber, currentData, nil)
 				} else {
 					diff, diffFound := pastData.DiffWith(currentData)
 					if diffFound {
 						changeDetected(packageNumber, currentData, diff)
 					} else {
-						log.LogPackage(packageNumber, "No change.")
+						log.LogPackage(packageNumber, i18n.Tr("cli.no_change"))
+						checkStuck(packageNumber, currentData)
+						checkPickup(packageNumber, currentData)
 					}
 				}
+				checkSLA(packageNumber, currentData)
 			} else {
-				log.LogPackage(packageNumber, "Not found in server")
+				log.LogPackage(packageNumber, i18n.Tr("cli.not_found"))
 			}
 		}
+		notifications.SendDigests(packages, time.Now())
+		notifications.EndCycle()
+		if *dryRun {
+			caching.Close()
+			return
+		}
 		time.Sleep(*tickerTime)
 	}
 }
 
+// testNotify sends a test notification through the configured channels and
+// returns the exit code, which is 1 when any channel failed
+func testNotify() int {
+	change, err := notifications.TestChange(*testPackage, notifications.EventType(*testEvent))
+	if err != nil {
+		panic(err)
+	}
+	results, err := notifications.Test(change, *testChannel)
+	if err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+	code := 0
+	for _, result := range results {
+		switch {
+		case result.Err == notifications.ErrNoRecipients:
+			fmt.Println(i18n.Tr("cli.test_no_recipients", result.Channel))
+		case result.Err != nil:
+			fmt.Println(i18n.Tr("cli.test_failed", result.Channel, result.Err))
+			code = 1
+		default:
+			fmt.Println(i18n.Tr("cli.test_ok", result.Channel))
+		}
+	}
+	return code
+}
+
+// slaReport prints the SLA of every cached package that has one
+func slaReport() {
+	numbers, err := caching.PackageNumbers()
+	if err != nil {
+		panic(err)
+	}
+	locale := i18n.Locale()
+	counts := map[string]int{}
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, strings.Join([]string{i18n.Tr("sla.package"), i18n.Tr("sla.type"), i18n.Tr("sla.start"), i18n.Tr("sla.deadline"), i18n.Tr("sla.days"), i18n.Tr("sla.result")}, "\t"))
+	for _, packageNumber := range numbers {
+		current, err := caching.GetPackage(packageNumber)
+		if err != nil {
+			panic(err)
+		}
+		sla, ok := notifications.PackageSLA(packageNumber, *current, time.Now())
+		if !ok {
+			continue
+		}
+		counts[sla.Result]++
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d/%d\t%s\n", packageNumber, current.Data[0].Type,
+			i18n.FormatDate(locale, sla.Start), i18n.FormatDate(locale, sla.Deadline),
+			sla.Elapsed, sla.Days, i18n.Tr("sla."+sla.Result))
+	}
+	table.Flush()
+	fmt.Println(i18n.Tr("sla.summary", counts[notifications.SLAOnTime], counts[notifications.SLALate], counts[notifications.SLAInProgress]))
+}
+
+// listExceptions prints the packages flagged with an exception
+func listExceptions() {
+	exceptions, err := caching.GetExceptions()
+	if err != nil {
+		panic(err)
+	}
+	if len(exceptions) == 0 {
+		fmt.Println(i18n.Tr("cli.exceptions_none"))
+		return
+	}
+	numbers := make([]string, 0, len(exceptions))
+	for packageNumber := range exceptions {
+		numbers = append(numbers, packageNumber)
+	}
+	sort.Strings(numbers)
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, packageNumber := range numbers {
+		e := exceptions[packageNumber]
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", packageNumber, i18n.FormatTime(i18n.Locale(), e.Since, settings.Location()), e.Movement.Date, e.Movement.Description)
+	}
+	table.Flush()
+}
+
+// acknowledge removes the exception flag of the given packages
+func acknowledge() {
+	for _, packageNumber := range *ackPackages {
+		found, err := caching.AcknowledgeException(packageNumber)
+		if err != nil {
+			panic(err)
+		}
+		if found {
+			fmt.Println(i18n.Tr("cli.ack", packageNumber))
+		} else {
+			fmt.Println(i18n.Tr("cli.ack_missing", packageNumber))
+		}
+	}
+}
+
+// unarchive polls again the given packages
+func unarchive() {
+	for _, packageNumber := range *unarchivePackages {
+		meta, err := caching.GetMeta(packageNumber)
+		if err != nil {
+			panic(err)
+		}
+		if !meta.Archived {
+			fmt.Println(i18n.Tr("cli.unarchive_missing", packageNumber))
+			continue
+		}
+		meta.Archived = false
+		if err := caching.SaveMeta(packageNumber, meta); err != nil {
+			panic(err)
+		}
+		fmt.Println(i18n.Tr("cli.unarchive", packageNumber))
+	}
+}
+
+// edit updates the metadata of a package with the given flags
+func edit() {
+	packageNumber := *editNumber
+	meta, err := caching.GetMeta(packageNumber)
+	if err != nil {
+		panic(err)
+	}
+	for flag, value := range map[string]*optionalString{"created": editCreated, "expected-delivery": editExpected} {
+		if _, err := time.Parse(calendar.DateLayout, value.value); value.value != "" && err != nil {
+			kingpin.Fatalf("--%s: invalid date %q, expected YYYY-MM-DD", flag, value.value)
+		}
+	}
+	fields := []struct {
+		flag  *optionalString
+		field *string
+	}{
+		{editLabel, &meta.Label},
+		{editNotes, &meta.Notes},
+		{editOwner, &meta.Owner},
+		{editCreated, &meta.Created},
+		{editExpected, &meta.ExpectedDelivery},
+	}
+	// The tags of the config file are not stored in the cache, so they
+	// can only be removed from the file
+	if p, found := settings.FindPackage(packageNumber); found {
+		for _, tag := range *editUntags {
+			for _, configured := range p.Tags {
+				if strings.EqualFold(configured, tag) {
+					kingpin.Fatalf("--untag: the tag %q of %s comes from the config file, remove it there", configured, packageNumber)
+				}
+			}
+		}
+	}
+	for _, f := range fields {
+		if f.flag.set {
+			*f.field = f.flag.value
+		}
+	}
+	meta.Tags, _ = caching.AddTags(meta.Tags, *editTags...)
+	meta.Tags, _ = caching.RemoveTags(meta.Tags, *editUntags...)
+	if err := caching.SaveMeta(packageNumber, meta); err != nil {
+		panic(err)
+	}
+	fmt.Println(i18n.Tr("cli.edited", packageNumber))
+}
+
+// listPackages prints the tracked packages with their metadata, filtered by
+// tag and owner
+func listPackages() {
+	numbers := packagesToList()
+	locale := i18n.Locale()
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, strings.Join([]string{i18n.Tr("list.package"), i18n.Tr("list.label"), i18n.Tr("list.status"), i18n.Tr("list.owner"), i18n.Tr("list.tags"), i18n.Tr("list.expected")}, "\t"))
+	for _, packageNumber := range numbers {
+		info, err := notifications.Info(packageNumber)
+		if err != nil {
+			panic(err)
+		}
+		if *listTag != "" && !info.HasTag(*listTag) {
+			continue
+		}
+		if *listOwner != "" && !strings.EqualFold(info.Owner, *listOwner) {
+			continue
+		}
+		current, err := caching.GetPackage(packageNumber)
+		if err != nil {
+			panic(err)
+		}
+		statusName := "-"
+		if current != nil {
+			statusName = status.Of(*current).LocalizedName(locale)
+		}
+		if info.Archived {
+			statusName += " " + i18n.Tr("list.archived")
+		}
+		mutes, err := caching.GetMutes(packageNumber)
+		if err != nil {
+			panic(err)
+		}
+		if mutes.PackageMuted(time.Now()) {
+			statusName += " " + i18n.Tr("list.muted")
+		}
+		expected := "-"
+		if !info.ExpectedDelivery.IsZero() {
+			expected = i18n.FormatDate(locale, info.ExpectedDelivery)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", packageNumber, orDash(info.Label), statusName,
+			orDash(info.Owner), orDash(strings.Join(info.Tags, ", ")), expected)
+	}
+	table.Flush()
+}
+
+// mute stops the notifications of a package, for everyone or for a recipient
+func mute() {
+	var until time.Time
+	if *muteFor != "" {
+		duration, err := settings.ParseDuration(*muteFor)
+		if err != nil {
+			kingpin.Fatalf("--for: %s", err)
+		}
+		until = time.Now().Add(duration)
+	}
+	if err := caching.SetMute(*muteNumber, *muteRecipient, until); err != nil {
+		panic(err)
+	}
+	label := *muteNumber
+	if *muteRecipient != "" {
+		label += " (" + *muteRecipient + ")"
+	}
+	if until.IsZero() {
+		fmt.Println(i18n.Tr("cli.muted_forever", label))
+	} else {
+		fmt.Println(i18n.Tr("cli.muted_until", label, i18n.FormatTime(i18n.Locale(), until, settings.Location())))
+	}
+}
+
+// unmute notifies a muted package again
+func unmute() {
+	found, err := caching.Unmute(*unmuteNumber, *unmuteRecipient)
+	if err != nil {
+		panic(err)
+	}
+	label := *unmuteNumber
+	if *unmuteRecipient != "" {
+		label += " (" + *unmuteRecipient + ")"
+	}
+	if found {
+		fmt.Println(i18n.Tr("cli.unmuted", label))
+	} else {
+		fmt.Println(i18n.Tr("cli.unmute_missing", label))
+	}
+}
+
+// packagesToList returns the packages of the config file, the subscribers
+// and the cache, including the archived ones
+func packagesToList() []string {
+	numbers := settings.PackageNumbers()
+	seen := map[string]bool{}
+	for _, packageNumber := range numbers {
+		seen[packageNumber] = true
+	}
+	subscribed, err := caching.SubscribedPackages()
+	if err != nil {
+		panic(err)
+	}
+	cached, err := caching.PackageNumbers()
+	if err != nil {
+		panic(err)
+	}
+	var others []string
+	for _, packageNumber := range append(subscribed, cached...) {
+		if !seen[packageNumber] {
+			seen[packageNumber] = true
+			others = append(others, packageNumber)
+		}
+	}
+	sort.Strings(others)
+	return append(numbers, others...)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// optionalString is a flag value that tells whether the flag was given
+type optionalString struct {
+	value string
+	set   bool
+}
+
+func (o *optionalString) Set(value string) error {
+	o.value, o.set = value, true
+	return nil
+}
+
+func (o *optionalString) String() string {
+	return o.value
+}
+
+func optionalFlag(command *kingpin.CmdClause, name string, help string) *optionalString {
+	value := &optionalString{}
+	command.Flag(name, help).SetValue(value)
+	return value
+}
+
+// listHolidays prints the holidays of the calendar
+func listHolidays() {
+	year := *holidaysYear
+	if year == 0 {
+		year = time.Now().Year()
+	}
+	for _, h := range calendar.Holidays(year) {
+		fmt.Printf("%s  %s\n", h.Date.Format(calendar.DateLayout), h.Name)
+	}
+}
+
+// withDefaultCommand adds the default command to the arguments when none
+// is given, so gocafier keeps running the poller with just flags
+func withDefaultCommand(args []string, defaultCommand string) []string {
+	for _, arg := range args {
+		switch arg {
+		case "--help", "--help-long", "--help-man", "--version":
+			return args
+		}
+		for _, command := range kingpin.CommandLine.Model().Commands {
+			if arg == command.Name {
+				return args
+			}
+		}
+	}
+	return append([]string{defaultCommand}, args...)
+}
+
+func eventNames() []string {
+	var names []string
+	for _, event := range notifications.EventTypes {
+		names = append(names, string(event))
+	}
+	return names
+}
+
+// register adds a notifier, which only writes what it would send in a dry run
+func register(n notifications.Notifier) {
+	if *dryRun {
+		n = &notifications.DryRunNotifier{Next: n, Dir: *dryRunDir}
+	}
+	notifications.Register(n)
+}
+
+// retryPendingNotifications delivers again the changes that some channels
+// failed to notify on previous polls
+func retryPendingNotifications() {
+	pending, err := caching.GetPending()
+	if err != nil {
+		panic(err)
+	}
+	for packageNumber, p := range pending {
+		currentData, err := caching.GetPackage(packageNumber)
+		if err != nil {
+			panic(err)
+		}
+		if currentData == nil {
+			continue
+		}
+		log.LogPackage(packageNumber, i18n.Tr("cli.retrying", strings.Join(p.Channels, ", ")))
+		change := notifications.Change{PackageNumber: packageNumber, Current: *currentData, Diff: p.Diff, Event: notifications.EventType(p.Event), Recipients: p.Recipients, PriorityOverride: status.Priority(p.Priority)}
+		failed := notifications.Retry(change, p.Channels)
+		p.Channels, p.Recipients = failed.Channels, failed.Recipients
+		err = caching.SetPending(packageNumber, p)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func startServer(addr string) {
+	mux := http.NewServeMux()
+	if *slackSecret != "" {
+		mux.Handle("/slack/command", slack.NewCommandHandler(*slackSecret))
+	}
+	if *linkSecret != "" {
+		handler := links.NewHandler(*linkSecret)
+		mux.Handle("/"+links.Mute, handler)
+		mux.Handle("/"+links.Unsubscribe, handler)
+	}
+	log.LogStd(i18n.Tr("cli.listening", addr), true)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		panic(err)
+	}
+}
+
+func newMQTTNotifier() *mqtt.Notifier {
+	config := settings.Values.MQTT
+	clientID := config.ClientID
+	if clientID == "" {
+		clientID = "gocafier"
+	}
+	return &mqtt.Notifier{
+		Options: mqtt.Options{
+			Broker:             config.Broker,
+			ClientID:           clientID,
+			Username:           *mqttUser,
+			Password:           *mqttPassword,
+			CAFile:             config.CAFile,
+			InsecureSkipVerify: config.InsecureSkipVerify,
+		},
+		TopicPrefix:     config.TopicPrefix,
+		QoS:             config.QoS,
+		DiscoveryPrefix: mqtt.DiscoveryPrefix(config.Discovery.Enabled, config.Discovery.Prefix),
+	}
+}
+
+// packagesToPoll merges the packages from the config file with the ones
+// tracked by subscribers, leaving out the ones archived by a rule
+func packagesToPoll() []string {
+	packages := settings.PackageNumbers()
+	subscribed, err := caching.SubscribedPackages()
+	if err != nil {
+		panic(err)
+	}
+	for _, packageNumber := range subscribed {
+		if !settings.HasPackage(packageNumber) {
+			packages = append(packages, packageNumber)
+		}
+	}
+	var active []string
+	for _, packageNumber := range packages {
+		meta, err := caching.GetMeta(packageNumber)
+		if err != nil {
+			panic(err)
+		}
+		if !meta.Archived {
+			active = append(active, packageNumber)
+		}
+	}
+	return active
+}
+
 func findPackage(packageNumber string, pastData *caching.OcaPackageDetail) (details caching.OcaPackageDetail, packageType string, found bool) {
 	var err error
 	var success bool
 	found = false
 	if pastData == nil {
-		for _, packageType = range ocaPackageTypes {
-			log.LogPackage(packageNumber, fmt.Sprintf("Checking in type '%s'", packageType))
+		for _, packageType = range settings.PackageTypes {
+			log.LogPackage(packageNumber, i18n.Tr("cli.checking_type", packageType))
 			details, success, err = ocaclient.RequestData(packageType, packageNumber)
 			if err != nil {
 				panic(err)
@@ -112,7 +721,7 @@ func findPackage(packageNumber string, pastData *caching.OcaPackageDetail) (deta
 		}
 	} else {
 		packageType = pastData.Data[0].Type
-		log.LogPackage(packageNumber, fmt.Sprintf("Found in type '%s'", packageType))
+		log.LogPackage(packageNumber, i18n.Tr("cli.found_type", packageType))
 		details, success, err = ocaclient.RequestData(packageType, packageNumber)
 		if err != nil {
 			panic(err)
@@ -123,11 +732,79 @@ func findPackage(packageNumber string, pastData *caching.OcaPackageDetail) (deta
 }
 
 func changeDetected(packageNumber string, currentData caching.OcaPackageDetail, diff []caching.DetailLog) {
-	var err error
-	log.LogPackage(packageNumber, "Change detected.")
-	err = notifications.Send(currentData, diff, *smtpUser, *smtpPassword)
+	log.LogPackage(packageNumber, i18n.Tr("cli.change_detected"))
+	change, notify := applyRules(notifications.Change{PackageNumber: packageNumber, Current: currentData, Diff: diff})
+	// A change muted by a rule is not flagged, so nobody has to acknowledge it
+	if notify {
+		if err := notifications.FlagException(change); err != nil {
+			panic(err)
+		}
+		send(change)
+	}
+	currentData.Save()
+}
+
+// checkStuck alerts when a package has not moved for too long
+func checkStuck(packageNumber string, currentData caching.OcaPackageDetail) {
+	change, stuck, err := notifications.Stuck(packageNumber, currentData, time.Now())
 	if err != nil {
 		panic(err)
 	}
-	currentData.Save()
+	if stuck {
+		dispatch(change)
+	}
+}
+
+// checkPickup reminds daily about a package waiting at a branch
+func checkPickup(packageNumber string, currentData caching.OcaPackageDetail) {
+	change, due, err := notifications.PickupReminder(packageNumber, currentData, time.Now())
+	if err != nil {
+		panic(err)
+	}
+	if due {
+		dispatch(change)
+	}
+}
+
+// checkSLA warns before a package misses its delivery deadline, and alerts
+// when it does
+func checkSLA(packageNumber string, currentData caching.OcaPackageDetail) {
+	change, due, err := notifications.CheckSLA(packageNumber, currentData, time.Now())
+	if err != nil {
+		panic(err)
+	}
+	if due {
+		dispatch(change)
+	}
+}
+
+// dispatch applies the rules to a change, notifies it through its channels
+// and records the ones that failed, to retry them on the next poll
+func dispatch(change notifications.Change) {
+	if change, notify := applyRules(change); notify {
+		send(change)
+	}
+}
+
+// applyRules runs the rules of the config on a change and tells whether it
+// is still notified
+func applyRules(change notifications.Change) (notifications.Change, bool) {
+	change, notify, err := rules.Apply(change, time.Now())
+	if err != nil {
+		panic(err)
+	}
+	return change, notify
+}
+
+// send notifies a change through every channel and queues the channels that
+// failed for the next poll
+func send(change notifications.Change) {
+	failed := notifications.NotifyAll(change)
+	if !failed.Empty() {
+		log.LogPackage(change.PackageNumber, i18n.Tr("cli.retry_later", strings.Join(failed.Channels, ", ")))
+		err := caching.AddPending(change.PackageNumber, caching.PendingNotification{Channels: failed.Channels, Recipients: failed.Recipients, Diff: change.Diff, Event: string(change.Event), Priority: int(change.PriorityOverride)})
+		if err != nil {
+			panic(err)
+		}
+	}
 }
@@ -0,0 +1,229 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Packet types of the MQTT 3.1.1 protocol used by the client
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetDisconnect = 14
+)
+
+const (
+	keepAlive      = 60
+	networkTimeout = 10 * time.Second
+)
+
+// Options configures the connection to the broker
+type Options struct {
+	// Broker is the broker URL: tcp://host:1883 or ssl://host:8883
+	Broker             string
+	ClientID           string
+	Username           string
+	Password           string
+	CAFile             string
+	InsecureSkipVerify bool
+}
+
+// Client is a minimal MQTT 3.1.1 client that can only publish
+type Client struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+}
+
+// Dial connects to the broker and completes the MQTT handshake
+func Dial(options Options) (*Client, error) {
+	brokerURL, err := url.Parse(options.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker %q: %s", options.Broker, err)
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: networkTimeout}
+	switch brokerURL.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", hostPort(brokerURL, "1883"))
+	case "ssl", "tls", "mqtts":
+		var config *tls.Config
+		config, err = tlsConfig(brokerURL.Hostname(), options)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostPort(brokerURL, "8883"), config)
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %q", brokerURL.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{conn: conn, reader: bufio.NewReader(conn)}
+	if err = c.connect(options); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	return u.Host
+}
+
+func tlsConfig(serverName string, options Options) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName, InsecureSkipVerify: options.InsecureSkipVerify}
+	if options.CAFile != "" {
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", options.CAFile)
+		}
+	}
+	return config, nil
+}
+
+func (c *Client) connect(options Options) error {
+	var flags byte = 0x02 // clean session
+	payload := encodeString(options.ClientID)
+	if options.Username != "" {
+		flags |= 0x80
+		payload = append(payload, encodeString(options.Username)...)
+		if options.Password != "" {
+			flags |= 0x40
+			payload = append(payload, encodeString(options.Password)...)
+		}
+	}
+
+	body := append(encodeString("MQTT"), 4, flags, byte(keepAlive>>8), byte(keepAlive&0xff))
+	body = append(body, payload...)
+	if err := c.write(packetConnect<<4, body); err != nil {
+		return err
+	}
+
+	packetType, ack, err := c.read()
+	if err != nil {
+		return err
+	}
+	if packetType != packetConnack || len(ack) != 2 {
+		return errors.New("unexpected response to CONNECT")
+	}
+	if ack[1] != 0 {
+		return fmt.Errorf("connection refused by broker (code %d)", ack[1])
+	}
+	return nil
+}
+
+// Publish sends a message to a topic. QoS 1 messages wait for the broker acknowledgement.
+func (c *Client) Publish(topic string, payload []byte, qos byte, retain bool) error {
+	if qos > 1 {
+		return fmt.Errorf("QoS %d is not supported", qos)
+	}
+	header := byte(packetPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+	body := encodeString(topic)
+	if qos > 0 {
+		c.packetID++
+		if c.packetID == 0 {
+			c.packetID = 1
+		}
+		body = append(body, byte(c.packetID>>8), byte(c.packetID&0xff))
+	}
+	body = append(body, payload...)
+	if err := c.write(header, body); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+
+	packetType, ack, err := c.read()
+	if err != nil {
+		return err
+	}
+	if packetType != packetPuback || len(ack) != 2 || uint16(ack[0])<<8|uint16(ack[1]) != c.packetID {
+		return fmt.Errorf("unexpected acknowledgement for %s", topic)
+	}
+	return nil
+}
+
+// Close disconnects from the broker
+func (c *Client) Close() error {
+	c.write(packetDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	packet := append([]byte{header}, encodeLength(len(body))...)
+	packet = append(packet, body...)
+	c.conn.SetWriteDeadline(time.Now().Add(networkTimeout))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+func (c *Client) read() (byte, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(networkTimeout))
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+		if multiplier > 128*128*128 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(c.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+func encodeString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s) & 0xff)}, s...)
+}
+
+func encodeLength(length int) []byte {
+	var encoded []byte
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		encoded = append(encoded, b)
+		if length == 0 {
+			return encoded
+		}
+	}
+}
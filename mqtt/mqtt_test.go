@@ -0,0 +1,414 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/notifications"
+)
+
+// connectPacket is a CONNECT as decoded by the fake broker
+type connectPacket struct {
+	protocol  string
+	level     byte
+	flags     byte
+	keepAlive uint16
+	clientID  string
+	username  string
+	password  string
+}
+
+// publishPacket is a PUBLISH as decoded by the fake broker
+type publishPacket struct {
+	topic    string
+	payload  []byte
+	qos      byte
+	retain   bool
+	packetID uint16
+}
+
+// fakeBroker accepts a single connection and records what the client sends
+type fakeBroker struct {
+	listener net.Listener
+	// refuse is the return code of the CONNACK
+	refuse byte
+	// wrongAck makes the broker acknowledge another packet identifier
+	wrongAck bool
+
+	connect    connectPacket
+	published  []publishPacket
+	disconnect bool
+	done       chan error
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{listener: listener, done: make(chan error, 1)}
+	go func() {
+		b.done <- b.serve()
+	}()
+	return b
+}
+
+func (b *fakeBroker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+// wait returns what the broker got once the client disconnected
+func (b *fakeBroker) wait(t *testing.T) {
+	if err := <-b.done; err != nil {
+		t.Fatal(err)
+	}
+	b.listener.Close()
+}
+
+func (b *fakeBroker) serve() error {
+	conn, err := b.listener.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		header, body, err := readPacket(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header >> 4 {
+		case packetConnect:
+			if b.connect, err = decodeConnect(body); err != nil {
+				return err
+			}
+			if _, err = conn.Write([]byte{packetConnack << 4, 2, 0, b.refuse}); err != nil {
+				return err
+			}
+		case packetPublish:
+			p, err := decodePublish(header, body)
+			if err != nil {
+				return err
+			}
+			b.published = append(b.published, p)
+			if p.qos == 1 {
+				id := p.packetID
+				if b.wrongAck {
+					id++
+				}
+				if _, err = conn.Write([]byte{packetPuback << 4, 2, byte(id >> 8), byte(id)}); err != nil {
+					return err
+				}
+			}
+		case packetDisconnect:
+			if header&0x0f != 0 || len(body) != 0 {
+				return fmt.Errorf("malformed DISCONNECT")
+			}
+			b.disconnect = true
+		default:
+			return fmt.Errorf("unexpected packet type %d", header>>4)
+		}
+	}
+}
+
+// readPacket decodes the fixed header and the remaining length of a packet
+func readPacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := 0
+	for shift := uint(0); ; shift += 7 {
+		if shift > 21 {
+			return 0, nil, fmt.Errorf("remaining length longer than 4 bytes")
+		}
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(reader, body)
+	return header, body, err
+}
+
+func readString(body []byte) (string, []byte, error) {
+	if len(body) < 2 {
+		return "", nil, fmt.Errorf("truncated string")
+	}
+	length := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+length {
+		return "", nil, fmt.Errorf("truncated string")
+	}
+	return string(body[2 : 2+length]), body[2+length:], nil
+}
+
+func decodeConnect(body []byte) (connectPacket, error) {
+	var c connectPacket
+	var err error
+	if c.protocol, body, err = readString(body); err != nil {
+		return c, err
+	}
+	if len(body) < 4 {
+		return c, fmt.Errorf("truncated CONNECT")
+	}
+	c.level, c.flags, c.keepAlive = body[0], body[1], binary.BigEndian.Uint16(body[2:])
+	body = body[4:]
+	if c.clientID, body, err = readString(body); err != nil {
+		return c, err
+	}
+	if c.flags&0x80 != 0 {
+		if c.username, body, err = readString(body); err != nil {
+			return c, err
+		}
+	}
+	if c.flags&0x40 != 0 {
+		if c.password, body, err = readString(body); err != nil {
+			return c, err
+		}
+	}
+	if len(body) != 0 {
+		return c, fmt.Errorf("%d extra bytes in CONNECT", len(body))
+	}
+	return c, nil
+}
+
+func decodePublish(header byte, body []byte) (publishPacket, error) {
+	p := publishPacket{qos: header >> 1 & 0x03, retain: header&0x01 != 0}
+	var err error
+	if p.topic, body, err = readString(body); err != nil {
+		return p, err
+	}
+	if p.qos > 0 {
+		if len(body) < 2 {
+			return p, fmt.Errorf("missing packet identifier")
+		}
+		p.packetID = binary.BigEndian.Uint16(body)
+		body = body[2:]
+	}
+	p.payload = body
+	return p, nil
+}
+
+func fixtureChange(t *testing.T) notifications.Change {
+	var current caching.OcaPackageDetail
+	fixture := `{"data":[{"type":"paquetes","code":"123123123123","log":[
+		{"date":"01/01/2016 10:00","description":"En tránsito"},
+		{"date":"02/01/2016 09:00","description":"En distribución"}]}]}`
+	if err := json.Unmarshal([]byte(fixture), &current); err != nil {
+		t.Fatal(err)
+	}
+	return notifications.Change{PackageNumber: "123123123123", Current: current, Diff: current.Data[0].Log[1:]}
+}
+
+func TestNotifyPublishesStateAndDiscovery(t *testing.T) {
+	broker := newFakeBroker(t)
+	n := &Notifier{
+		Options:         Options{Broker: broker.url(), ClientID: "gocafier-test", Username: "user", Password: "secret"},
+		TopicPrefix:     "oca",
+		QoS:             1,
+		DiscoveryPrefix: DiscoveryPrefix(true, ""),
+	}
+	if err := n.Notify(fixtureChange(t)); err != nil {
+		t.Fatal(err)
+	}
+	broker.wait(t)
+
+	c := broker.connect
+	if c.protocol != "MQTT" || c.level != 4 || c.keepAlive != keepAlive {
+		t.Errorf("CONNECT = %+v, want MQTT 3.1.1", c)
+	}
+	if c.flags != 0xc2 || c.clientID != "gocafier-test" || c.username != "user" || c.password != "secret" {
+		t.Errorf("CONNECT flags %#x, client %q, user %q, password %q", c.flags, c.clientID, c.username, c.password)
+	}
+	if !broker.disconnect {
+		t.Error("the client did not send DISCONNECT")
+	}
+
+	want := []struct {
+		topic  string
+		retain bool
+	}{
+		{"homeassistant/sensor/gocafier_123123123123/status/config", true},
+		{"homeassistant/sensor/gocafier_123123123123/last_event/config", true},
+		{"oca/123123123123/status", true},
+		{"oca/123123123123/last_event", true},
+		{"oca/123123123123/last_update", true},
+		{"oca/123123123123/attributes", true},
+		{"oca/123123123123/events", false},
+	}
+	if len(broker.published) != len(want) {
+		t.Fatalf("published %d messages, want %d", len(broker.published), len(want))
+	}
+	ids := make(map[uint16]bool)
+	for i, w := range want {
+		p := broker.published[i]
+		if p.topic != w.topic || p.retain != w.retain || p.qos != 1 {
+			t.Errorf("message %d: topic %q retain %v qos %d, want %q retain %v qos 1", i, p.topic, p.retain, p.qos, w.topic, w.retain)
+		}
+		if p.packetID == 0 || ids[p.packetID] {
+			t.Errorf("message %d: packet identifier %d is zero or repeated", i, p.packetID)
+		}
+		ids[p.packetID] = true
+	}
+
+	var config discoveryConfig
+	if err := json.Unmarshal(broker.published[0].payload, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.UniqueID != "gocafier_123123123123_status" || config.StateTopic != "oca/123123123123/status" ||
+		config.JSONAttributesTopic != "oca/123123123123/attributes" || config.Device.Identifiers[0] != "gocafier_123123123123" {
+		t.Errorf("discovery config = %+v", config)
+	}
+	if status := string(broker.published[2].payload); status != "out_for_delivery" {
+		t.Errorf("status = %q, want out_for_delivery", status)
+	}
+	if last := string(broker.published[3].payload); last != "En distribución" {
+		t.Errorf("last_event = %q", last)
+	}
+	var event struct {
+		Package   string              `json:"package"`
+		Event     string              `json:"event"`
+		FirstSeen bool                `json:"first_seen"`
+		Movements []caching.DetailLog `json:"movements"`
+	}
+	if err := json.Unmarshal(broker.published[6].payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Package != "123123123123" || event.Event != "out_for_delivery" || event.FirstSeen || len(event.Movements) != 1 {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestNotifyWithoutDiscovery(t *testing.T) {
+	broker := newFakeBroker(t)
+	n := &Notifier{Options: Options{Broker: broker.url(), ClientID: "gocafier-test"}}
+	if err := n.Notify(fixtureChange(t)); err != nil {
+		t.Fatal(err)
+	}
+	broker.wait(t)
+	if broker.connect.flags != 0x02 {
+		t.Errorf("CONNECT flags = %#x, want a clean session without credentials", broker.connect.flags)
+	}
+	for _, p := range broker.published {
+		if strings.HasPrefix(p.topic, defaultDiscoveryPrefix) {
+			t.Errorf("published discovery topic %q with discovery disabled", p.topic)
+		}
+		if !strings.HasPrefix(p.topic, defaultTopicPrefix+"/123123123123/") {
+			t.Errorf("topic %q does not use the default prefix", p.topic)
+		}
+		if p.qos != 0 || p.packetID != 0 {
+			t.Errorf("%s: QoS %d with packet identifier %d, want QoS 0", p.topic, p.qos, p.packetID)
+		}
+	}
+}
+
+func TestNotifyTestChange(t *testing.T) {
+	broker := newFakeBroker(t)
+	n := &Notifier{Options: Options{Broker: broker.url(), ClientID: "gocafier-test"}, DiscoveryPrefix: DiscoveryPrefix(true, "")}
+	change := fixtureChange(t)
+	change.Test = true
+	if err := n.Notify(change); err != nil {
+		t.Fatal(err)
+	}
+	broker.wait(t)
+	if len(broker.published) != 5 {
+		t.Errorf("published %d messages, want the state and the event only", len(broker.published))
+	}
+	for _, p := range broker.published {
+		if p.retain {
+			t.Errorf("test change retained on %q", p.topic)
+		}
+		if strings.HasPrefix(p.topic, defaultDiscoveryPrefix) {
+			t.Errorf("test change announced %q to Home Assistant", p.topic)
+		}
+		if !strings.HasPrefix(p.topic, defaultTopicPrefix+"/test/123123123123/") {
+			t.Errorf("test change published to %q, outside the test topic", p.topic)
+		}
+	}
+}
+
+func TestPublishLargePayloads(t *testing.T) {
+	broker := newFakeBroker(t)
+	client, err := Dial(Options{Broker: broker.url(), ClientID: "gocafier-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The remaining length also counts the topic and the packet identifier,
+	// so these sizes cross the 1, 2 and 3 byte boundaries
+	sizes := []int{0, 120, 127, 128, 16380, 16384, 300000}
+	for i, size := range sizes {
+		payload := bytes.Repeat([]byte{byte('a' + i)}, size)
+		if err = client.Publish("big", payload, byte(i%2), false); err != nil {
+			t.Fatalf("publish %d bytes: %s", size, err)
+		}
+	}
+	client.Close()
+	broker.wait(t)
+
+	if len(broker.published) != len(sizes) {
+		t.Fatalf("broker got %d messages, want %d", len(broker.published), len(sizes))
+	}
+	for i, p := range broker.published {
+		if len(p.payload) != sizes[i] || (sizes[i] > 0 && p.payload[sizes[i]-1] != byte('a'+i)) {
+			t.Errorf("message %d: got %d bytes, want %d", i, len(p.payload), sizes[i])
+		}
+	}
+}
+
+func TestEncodeLength(t *testing.T) {
+	// The boundaries of the MQTT 3.1.1 specification, section 2.2.3
+	tests := map[int][]byte{
+		0:         {0x00},
+		127:       {0x7f},
+		128:       {0x80, 0x01},
+		16383:     {0xff, 0x7f},
+		16384:     {0x80, 0x80, 0x01},
+		2097151:   {0xff, 0xff, 0x7f},
+		2097152:   {0x80, 0x80, 0x80, 0x01},
+		268435455: {0xff, 0xff, 0xff, 0x7f},
+	}
+	for length, want := range tests {
+		if got := encodeLength(length); !bytes.Equal(got, want) {
+			t.Errorf("encodeLength(%d) = % x, want % x", length, got, want)
+		}
+	}
+}
+
+func TestPublishRejectsWrongAcknowledgement(t *testing.T) {
+	broker := newFakeBroker(t)
+	broker.wrongAck = true
+	client, err := Dial(Options{Broker: broker.url(), ClientID: "gocafier-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Publish("topic", []byte("payload"), 1, true); err == nil {
+		t.Error("a PUBACK for another packet was accepted")
+	}
+	client.Close()
+	broker.wait(t)
+}
+
+func TestConnectionRefused(t *testing.T) {
+	broker := newFakeBroker(t)
+	broker.refuse = 5
+	if _, err := Dial(Options{Broker: broker.url(), ClientID: "gocafier-test", Username: "user", Password: "wrong"}); err == nil {
+		t.Error("Dial succeeded after the broker refused the connection")
+	}
+	broker.wait(t)
+}
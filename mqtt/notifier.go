@@ -0,0 +1,182 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/notifications"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+const (
+	defaultTopicPrefix     = "gocafier"
+	defaultDiscoveryPrefix = "homeassistant"
+)
+
+// Notifier publishes the state of each package and its change events to an MQTT broker
+type Notifier struct {
+	Options Options
+	// TopicPrefix is prepended to every package topic
+	TopicPrefix string
+	QoS         byte
+	// DiscoveryPrefix enables Home Assistant MQTT discovery when not empty
+	DiscoveryPrefix string
+}
+
+type packageState struct {
+	Package    string `json:"package"`
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	LastEvent  string `json:"last_event"`
+	LastUpdate string `json:"last_update"`
+}
+
+type changeEvent struct {
+	packageState
+	Movements interface{} `json:"movements"`
+	FirstSeen bool        `json:"first_seen"`
+	Event     string      `json:"event"`
+}
+
+type discoveryConfig struct {
+	Name                string          `json:"name"`
+	UniqueID            string          `json:"unique_id"`
+	StateTopic          string          `json:"state_topic"`
+	JSONAttributesTopic string          `json:"json_attributes_topic"`
+	Icon                string          `json:"icon"`
+	Device              discoveryDevice `json:"device"`
+}
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// Name returns the channel name
+func (n *Notifier) Name() string {
+	return "mqtt"
+}
+
+// Notify publishes the retained package state and a change event. Test
+// changes are published without retain or discovery under the test topic of
+// the package, so Home Assistant never takes them as the package state.
+func (n *Notifier) Notify(change notifications.Change) error {
+	client, err := Dial(n.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	state := packageState{
+		Package: change.PackageNumber,
+		Type:    change.Current.Data[0].Type,
+		Status:  string(status.Of(change.Current)),
+	}
+	if movement, ok := change.Current.LastMovement(); ok {
+		state.LastEvent = movement.Description
+		state.LastUpdate = movement.Date
+	}
+	attributes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	event, err := json.Marshal(changeEvent{packageState: state, Movements: change.Movements(), FirstSeen: change.Diff == nil, Event: string(change.Type())})
+	if err != nil {
+		return err
+	}
+
+	base := n.packageTopic(change.PackageNumber)
+	if change.Test {
+		base = n.testTopic(change.PackageNumber)
+	}
+	messages := []struct {
+		topic   string
+		payload []byte
+		retain  bool
+	}{
+		{base + "/status", []byte(state.Status), true},
+		{base + "/last_event", []byte(state.LastEvent), true},
+		{base + "/last_update", []byte(state.LastUpdate), true},
+		{base + "/attributes", attributes, true},
+		{base + "/events", event, false},
+	}
+	if n.DiscoveryPrefix != "" && !change.Test {
+		if err = n.publishDiscovery(client, change.PackageNumber); err != nil {
+			return err
+		}
+	}
+	for _, m := range messages {
+		if err = client.Publish(m.topic, m.payload, n.QoS, m.retain && !change.Test); err != nil {
+			return fmt.Errorf("publish %s: %s", m.topic, err)
+		}
+	}
+	log.LogPackage(change.PackageNumber, i18n.Tr("cli.mqtt_published", base))
+	return nil
+}
+
+func (n *Notifier) prefix() string {
+	if n.TopicPrefix == "" {
+		return defaultTopicPrefix
+	}
+	return n.TopicPrefix
+}
+
+func (n *Notifier) packageTopic(packageNumber string) string {
+	return n.prefix() + "/" + packageNumber
+}
+
+// testTopic is where test-notify publishes, apart from the state topics
+func (n *Notifier) testTopic(packageNumber string) string {
+	return n.prefix() + "/test/" + packageNumber
+}
+
+// publishDiscovery announces the status and last event sensors of a package to Home Assistant
+func (n *Notifier) publishDiscovery(client *Client, packageNumber string) error {
+	nodeID := "gocafier_" + packageNumber
+	device := discoveryDevice{
+		Identifiers:  []string{nodeID},
+		Name:         "OCA " + packageNumber,
+		Manufacturer: "OCA",
+	}
+	sensors := []struct {
+		objectID string
+		name     string
+		icon     string
+	}{
+		{"status", "status", "mdi:package-variant-closed"},
+		{"last_event", "last event", "mdi:truck-delivery"},
+	}
+	for _, sensor := range sensors {
+		config, err := json.Marshal(discoveryConfig{
+			Name:                fmt.Sprintf("OCA %s %s", packageNumber, sensor.name),
+			UniqueID:            nodeID + "_" + sensor.objectID,
+			StateTopic:          n.packageTopic(packageNumber) + "/" + sensor.objectID,
+			JSONAttributesTopic: n.packageTopic(packageNumber) + "/attributes",
+			Icon:                sensor.icon,
+			Device:              device,
+		})
+		if err != nil {
+			return err
+		}
+		topic := fmt.Sprintf("%s/sensor/%s/%s/config", n.DiscoveryPrefix, nodeID, sensor.objectID)
+		if err = client.Publish(topic, config, n.QoS, true); err != nil {
+			return fmt.Errorf("publish %s: %s", topic, err)
+		}
+	}
+	return nil
+}
+
+// DiscoveryPrefix returns the prefix to use for Home Assistant discovery,
+// or an empty string when discovery is disabled
+func DiscoveryPrefix(enabled bool, prefix string) string {
+	if !enabled {
+		return ""
+	}
+	if prefix == "" {
+		return defaultDiscoveryPrefix
+	}
+	return prefix
+}
@@ -0,0 +1,283 @@
+package notifications
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/calendar"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+const (
+	emailChannel = "email"
+)
+
+// defaultImmediate are the statuses notified right away, even in digest mode
+var defaultImmediate = []string{string(status.OutForDelivery), string(status.DeliveryFailed), string(status.Returned)}
+
+// Digest summarizes the tracked packages since the previous digest of a channel
+type Digest struct {
+	Since time.Time
+	Until time.Time
+	// Recipient limits an email digest to an address with its own schedule.
+	// When empty, the digest goes to the recipients on the shared schedule.
+	Recipient string
+	// Moved are the packages with new movements
+	Moved []DigestEntry
+	// Idle are the active packages that did not move
+	Idle []DigestEntry
+}
+
+// DigestEntry is a package in a digest
+type DigestEntry struct {
+	PackageNumber string
+	Current       caching.OcaPackageDetail
+	// Movements holds the movements since the previous digest
+	Movements []caching.DetailLog
+}
+
+// Status returns the canonical status of the package
+func (e DigestEntry) Status() status.Status {
+	return status.Of(e.Current)
+}
+
+// Empty tells whether the digest has no package at all
+func (d Digest) Empty() bool {
+	return len(d.Moved) == 0 && len(d.Idle) == 0
+}
+
+// Filter returns the digest with the packages accepted by keep only
+func (d Digest) Filter(keep func(packageNumber string) bool) Digest {
+	filtered := Digest{Since: d.Since, Until: d.Until, Recipient: d.Recipient}
+	for _, e := range d.Moved {
+		if keep(e.PackageNumber) {
+			filtered.Moved = append(filtered.Moved, e)
+		}
+	}
+	for _, e := range d.Idle {
+		if keep(e.PackageNumber) {
+			filtered.Idle = append(filtered.Idle, e)
+		}
+	}
+	return filtered
+}
+
+// DigestNotifier is implemented by the notifiers that can deliver digests
+type DigestNotifier interface {
+	NotifyDigest(d Digest) error
+}
+
+// Immediate tells whether a change is notified right away even in digest
+// mode, because its status is urgent or it is an exception
+func Immediate(change Change) bool {
+	if IsException(change) {
+		return true
+	}
+	immediate := settings.Values.Digest.Immediate
+	if immediate == nil {
+		immediate = defaultImmediate
+	}
+	current := string(status.Of(change.Current))
+	for _, s := range immediate {
+		if s == current {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckDigest validates the digest settings against the registered notifiers
+func CheckDigest() error {
+	for _, s := range settings.Values.Digest.Immediate {
+		if _, ok := status.Parse(s); !ok {
+			return fmt.Errorf("digest.immediate: unknown status %q", s)
+		}
+	}
+	for _, name := range settings.Values.Digest.AllChannels() {
+		n, found := findNotifier(name)
+		if !found {
+			return fmt.Errorf("digest.channels: unknown channel %q", name)
+		}
+		if d, ok := n.(*DryRunNotifier); ok {
+			n = d.Unwrap()
+		}
+		if _, ok := n.(DigestNotifier); !ok {
+			return fmt.Errorf("digest.channels: %s does not support digests", name)
+		}
+	}
+	return nil
+}
+
+// queueForDigest adds the change to the digest of the notifier and tells
+// whether it must be held for it. Urgent changes are recorded in the digest
+// too, but are also notified right away. The email notifier is never queued
+// here, since it picks its digest recipients by itself.
+func queueForDigest(n Notifier, change Change) (bool, error) {
+	if n.Name() == emailChannel || !settings.Values.Digest.HasChannel(n.Name()) {
+		return false, nil
+	}
+	if err := caching.AddToDigest(n.Name(), change.PackageNumber, change.Movements()); err != nil {
+		return false, err
+	}
+	if Immediate(change) {
+		return false, nil
+	}
+	log.LogPackage(change.PackageNumber, i18n.Tr("cli.digest_queued", n.Name()))
+	return true, nil
+}
+
+// SendDigests delivers the digests that are due. packages are the tracked
+// ones, so the packages that did not move can be listed too.
+func SendDigests(packages []string, now time.Time) {
+	for _, target := range digestTargets() {
+		n, found := findNotifier(target.channel)
+		if !found {
+			continue
+		}
+		notifier, ok := n.(DigestNotifier)
+		if !ok {
+			continue
+		}
+		pending, found, err := caching.GetDigest(target.key)
+		if err != nil {
+			log.LogError(i18n.Tr("error.digest_read", target.key), err)
+			continue
+		}
+		if !found {
+			// The first digest covers from now on
+			if err = caching.SaveDigest(target.key, caching.Digest{LastSent: now}); err != nil {
+				log.LogError(i18n.Tr("error.digest_start", target.key), err)
+			}
+			continue
+		}
+		if nextDigest(pending.LastSent, target.schedule).After(now) {
+			continue
+		}
+		d, err := buildDigest(packages, pending, now)
+		if err != nil {
+			log.LogError(i18n.Tr("error.digest_build", target.key), err)
+			continue
+		}
+		d.Recipient = target.recipient
+		if !d.Empty() {
+			if err = notifier.NotifyDigest(d); err != nil {
+				log.LogError(i18n.Tr("error.digest_failed", target.key), err)
+				continue
+			}
+			log.LogStd(i18n.Tr("cli.digest_sent", target.key), true)
+		}
+		if err = caching.SaveDigest(target.key, caching.Digest{LastSent: now}); err != nil {
+			log.LogError(i18n.Tr("error.digest_reset", target.key), err)
+		}
+	}
+}
+
+// digestTarget is a digest with its own schedule and pending changes
+type digestTarget struct {
+	// key names the digest in the cache
+	key     string
+	channel string
+	// recipient is the email address of the digest, for the addresses with
+	// their own schedule
+	recipient string
+	schedule  settings.DigestSchedule
+}
+
+// digestTargets returns a digest for each channel in digest mode, one for
+// the email recipients on the shared schedule and one for each email
+// recipient with its own schedule
+func digestTargets() []digestTarget {
+	config := settings.Values.Digest
+	var targets []digestTarget
+	for _, name := range config.AllChannels() {
+		targets = append(targets, digestTarget{key: name, channel: name, schedule: config.ChannelSchedule(name)})
+	}
+	if len(config.Recipients) > 0 && !config.HasChannel(emailChannel) {
+		targets = append(targets, digestTarget{key: emailChannel, channel: emailChannel, schedule: config.Default()})
+	}
+	for _, address := range config.ScheduledRecipients() {
+		schedule, _ := config.RecipientSchedule(address)
+		targets = append(targets, digestTarget{key: emailDigestKey(address), channel: emailChannel, recipient: address, schedule: schedule})
+	}
+	return targets
+}
+
+// emailDigestKey returns the digest that collects the changes of an email
+// address in digest mode
+func emailDigestKey(address string) string {
+	if _, found := settings.Values.Digest.RecipientSchedule(address); found {
+		return emailChannel + ":" + strings.ToLower(address)
+	}
+	return emailChannel
+}
+
+func findNotifier(name string) (Notifier, bool) {
+	for _, n := range notifiers {
+		if n.Name() == name {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// nextDigest returns the first time after t that a digest is due on a schedule
+func nextDigest(t time.Time, schedule settings.DigestSchedule) time.Time {
+	hour, minute, _ := schedule.Clock()
+	day, weekly, _ := schedule.Day()
+	location := settings.Location()
+	if location == nil {
+		location = time.Local
+	}
+	t = t.In(location)
+	next := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, location)
+	for !next.After(t) || (weekly && next.Weekday() != day) {
+		next = next.AddDate(0, 0, 1)
+	}
+	if settings.Values.Digest.BusinessDays {
+		next = calendar.NextBusinessDay(next)
+	}
+	return next
+}
+
+func buildDigest(packages []string, pending caching.Digest, now time.Time) (Digest, error) {
+	d := Digest{Since: pending.LastSent, Until: now}
+	codes := append([]string{}, packages...)
+	var extra []string
+	for code := range pending.Movements {
+		if !containsString(codes, code) {
+			extra = append(extra, code)
+		}
+	}
+	sort.Strings(extra)
+	for _, code := range append(codes, extra...) {
+		current, err := caching.GetPackage(code)
+		if err != nil {
+			return d, err
+		}
+		if current == nil || packageMuted(code, now) {
+			continue
+		}
+		entry := DigestEntry{PackageNumber: code, Current: *current, Movements: pending.Movements[code]}
+		if len(entry.Movements) > 0 {
+			d.Moved = append(d.Moved, entry)
+		} else if !entry.Status().IsFinal() {
+			d.Idle = append(d.Idle, entry)
+		}
+	}
+	return d, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/status"
+	"gopkg.in/gomail.v2"
+)
+
+var dryRunCount int
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// NewDryRunSender returns a sender that writes each email it is given,
+// as an .eml file in dir or to stdout when dir is empty, instead of sending it
+func NewDryRunSender(dir string) gomail.Sender {
+	return gomail.SendFunc(func(from string, to []string, msg io.WriterTo) error {
+		var eml bytes.Buffer
+		// Bcc recipients are not in the headers, so the envelope is kept too
+		fmt.Fprintf(&eml, "X-Envelope-From: %s\r\nX-Envelope-To: %s\r\n", from, strings.Join(to, ", "))
+		if _, err := msg.WriteTo(&eml); err != nil {
+			return err
+		}
+		return writeDryRun(dir, emailChannel, "eml", eml.Bytes())
+	})
+}
+
+// DryRunNotifier writes the changes that a notifier would send as JSON,
+// instead of sending them
+type DryRunNotifier struct {
+	Next Notifier
+	// Dir is where the files are written. Stdout is used when empty.
+	Dir string
+}
+
+type dryRunChange struct {
+	Channel   string              `json:"channel"`
+	Package   string              `json:"package"`
+	Event     EventType           `json:"event"`
+	Status    status.Status       `json:"status"`
+	FirstSeen bool                `json:"first_seen"`
+	Movements []caching.DetailLog `json:"movements"`
+}
+
+type dryRunDigest struct {
+	Channel   string    `json:"channel"`
+	Recipient string    `json:"recipient,omitempty"`
+	Since     time.Time `json:"since"`
+	Until     time.Time `json:"until"`
+	Moved     []string  `json:"moved"`
+	Idle      []string  `json:"idle"`
+}
+
+// Name returns the name of the wrapped notifier, so the settings that refer
+// to it by name still apply
+func (d *DryRunNotifier) Name() string {
+	return d.Next.Name()
+}
+
+// Unwrap returns the wrapped notifier
+func (d *DryRunNotifier) Unwrap() Notifier {
+	return d.Next
+}
+
+// Notify writes the change as JSON
+func (d *DryRunNotifier) Notify(change Change) error {
+	data, err := json.MarshalIndent(dryRunChange{
+		Channel:   d.Next.Name(),
+		Package:   change.PackageNumber,
+		Event:     change.Type(),
+		Status:    status.Of(change.Current),
+		FirstSeen: change.Diff == nil,
+		Movements: change.Movements(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeDryRun(d.Dir, d.Next.Name(), "json", data)
+}
+
+// NotifyDigest writes the packages of the digest as JSON
+func (d *DryRunNotifier) NotifyDigest(digest Digest) error {
+	if _, ok := d.Next.(DigestNotifier); !ok {
+		return fmt.Errorf("%s does not support digests", d.Next.Name())
+	}
+	payload := dryRunDigest{Channel: d.Next.Name(), Recipient: digest.Recipient, Since: digest.Since, Until: digest.Until}
+	for _, e := range digest.Moved {
+		payload.Moved = append(payload.Moved, e.PackageNumber)
+	}
+	for _, e := range digest.Idle {
+		payload.Idle = append(payload.Idle, e.PackageNumber)
+	}
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeDryRun(d.Dir, d.Next.Name()+"-digest", "json", data)
+}
+
+func writeDryRun(dir string, channel string, extension string, data []byte) error {
+	dryRunCount++
+	if dir == "" {
+		fmt.Printf("----- dry run #%d: %s -----\n%s\n", dryRunCount, channel, data)
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%03d-%s.%s", time.Now().Format("20060102-150405"), dryRunCount, unsafeFileChars.ReplaceAllString(channel, "_"), extension)
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	log.LogStd(i18n.Tr("cli.dry_run", channel, path), true)
+	return nil
+}
@@ -0,0 +1,70 @@
+package notifications
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+// Exception returns the latest new movement of a change that is an
+// exception, such as a failed delivery, an address problem or a return to
+// sender. For packages seen for the first time only the current status counts.
+func Exception(change Change) (caching.DetailLog, bool) {
+	if change.Diff == nil {
+		last, ok := change.Current.LastMovement()
+		return last, ok && status.Of(change.Current).IsException()
+	}
+	for i := len(change.Diff) - 1; i >= 0; i-- {
+		if status.Classify(change.Diff[i].Description).IsException() {
+			return change.Diff[i], true
+		}
+	}
+	return caching.DetailLog{}, false
+}
+
+// IsException tells whether a change has an exception to escalate
+func IsException(change Change) bool {
+	_, ok := Exception(change)
+	return ok
+}
+
+// Priority returns how urgent the change is. Exceptions are always urgent,
+// unless a rule set another priority.
+func (c Change) Priority() status.Priority {
+	if c.PriorityOverride > 0 {
+		return c.PriorityOverride
+	}
+	if IsException(c) {
+		return status.PriorityUrgent
+	}
+	return status.Of(c.Current).Priority()
+}
+
+// FlagException flags the package of a change with an exception in the
+// cache, until it is acknowledged
+func FlagException(change Change) error {
+	movement, ok := Exception(change)
+	if !ok {
+		return nil
+	}
+	log.LogPackage(change.PackageNumber, i18n.Tr("cli.exception_flagged", movement.Description, change.PackageNumber))
+	return caching.FlagException(change.PackageNumber, caching.Exception{Movement: movement, Since: time.Now()})
+}
+
+// CheckEscalation validates the escalation channels against the registered notifiers
+func CheckEscalation() error {
+	for _, name := range settings.Values.Escalation.Channels {
+		if _, found := findNotifier(name); !found {
+			return fmt.Errorf("escalation.channels: unknown channel %q", name)
+		}
+		if settings.Values.Digest.HasChannel(name) {
+			return fmt.Errorf("escalation.channels: %s is also in digest.channels", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package notifications
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+)
+
+const (
+	defaultRelayCooldown = 5 * time.Minute
+)
+
+// Failover is a gomail.Sender that tries several SMTP relays in order of
+// priority. A relay that fails is skipped until its cooldown period is over.
+type Failover struct {
+	Cooldown time.Duration
+
+	mutex  sync.Mutex
+	relays []*relay
+}
+
+type relay struct {
+	name           string
+	transport      *Transport
+	unhealthyUntil time.Time
+}
+
+// NewFailover builds a Failover from the relays of the config file
+func NewFailover(servers []settings.SMTPServer, cooldown time.Duration, username string, password string) (*Failover, error) {
+	if cooldown <= 0 {
+		cooldown = defaultRelayCooldown
+	}
+	sorted := append([]settings.SMTPServer{}, servers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	f := &Failover{Cooldown: cooldown}
+	for _, server := range sorted {
+		transport, err := NewSMTPTransport(server, username, password)
+		if err != nil {
+			return nil, fmt.Errorf("relay %s: %s", server.Server, err)
+		}
+		f.relays = append(f.relays, &relay{
+			name:      net.JoinHostPort(server.Server, strconv.Itoa(server.Port)),
+			transport: transport,
+		})
+	}
+	return f, nil
+}
+
+// Send delivers the message through the first healthy relay. When every
+// relay is cooling down, all of them are tried anyway.
+func (f *Failover) Send(from string, to []string, msg io.WriterTo) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := time.Now()
+	var candidates []*relay
+	for _, r := range f.relays {
+		if now.After(r.unhealthyUntil) {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		log.LogStd(i18n.Tr("cli.relays_unhealthy"), true)
+		candidates = f.relays
+	}
+
+	var failures []string
+	for _, r := range candidates {
+		err := r.transport.Send(from, to, msg)
+		if err == nil {
+			r.unhealthyUntil = time.Time{}
+			log.LogStd(i18n.Tr("cli.relay_delivered", strings.Join(to, ", "), r.name), true)
+			return nil
+		}
+		r.unhealthyUntil = time.Now().Add(f.Cooldown)
+		log.LogError(i18n.Tr("error.relay_failed", r.name, f.Cooldown), err)
+		failures = append(failures, fmt.Sprintf("%s: %s", r.name, err))
+	}
+	return fmt.Errorf("every SMTP relay failed (%s)", strings.Join(failures, "; "))
+}
+
+// CloseCycle closes the connections opened to the relays during the poll cycle
+func (f *Failover) CloseCycle() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var err error
+	for _, r := range f.relays {
+		if closeErr := r.transport.CloseCycle(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
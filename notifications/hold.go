@@ -0,0 +1,198 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+// lastSent is when each package was last notified, for the package rate
+// limit. Like recentlySent, it is only kept in memory, so the limits start
+// over when gocafier restarts; the held changes themselves are cached.
+var lastSent = make(map[string]time.Time)
+
+// recentlySent holds when the latest notifications went out, for the global rate limit
+var recentlySent []time.Time
+
+// Urgent tells whether a change goes out even during quiet hours or when
+// the rate limits are exceeded
+func Urgent(change Change) bool {
+	return change.Priority() >= status.PriorityUrgent
+}
+
+// rateLimited tells whether notifying a package now would exceed a rate limit
+func rateLimited(packageNumber string, now time.Time) bool {
+	limit := settings.Values.RateLimit
+	if limit.Package > 0 {
+		if last, ok := lastSent[packageNumber]; ok && now.Sub(last) < limit.Package {
+			return true
+		}
+	}
+	if limit.Global > 0 {
+		var recent []time.Time
+		for _, t := range recentlySent {
+			if now.Sub(t) < limit.Window {
+				recent = append(recent, t)
+			}
+		}
+		recentlySent = recent
+		if len(recentlySent) >= limit.Global {
+			return true
+		}
+	}
+	return false
+}
+
+func recordSent(packageNumber string, now time.Time) {
+	lastSent[packageNumber] = now
+	recentlySent = append(recentlySent, now)
+}
+
+// hold stores a change to notify it later through a channel, or through
+// every channel when channel is empty
+func hold(channel string, recipient string, change Change, reason string) error {
+	target := channel
+	if recipient != "" {
+		target = channel + ":" + recipient
+	}
+	if target == "" {
+		target = i18n.Tr("cli.every_channel")
+	}
+	log.LogPackage(change.PackageNumber, i18n.Tr("cli.held", target, reason))
+	return caching.Hold(caching.HeldNotification{
+		Channel:   channel,
+		Recipient: recipient,
+		Code:      change.PackageNumber,
+		Diff:      change.Diff,
+		Event:     string(change.Event),
+		Since:     time.Now(),
+		Channels:  change.Channels,
+		Priority:  int(change.PriorityOverride),
+	})
+}
+
+// holdForRateLimit holds a change over the rate limits, or any change of a
+// package that already has one held, and tells whether it was held
+func holdForRateLimit(change Change, now time.Time) bool {
+	limit := settings.Values.RateLimit
+	if limit.Package <= 0 && limit.Global <= 0 {
+		return false
+	}
+	held, err := caching.IsHeld(change.PackageNumber)
+	if err != nil {
+		log.LogError(fmt.Sprintf("P:%s - %s", change.PackageNumber, i18n.Tr("error.read_held")), err)
+		return false
+	}
+	if !held && !rateLimited(change.PackageNumber, now) {
+		return false
+	}
+	if err = hold("", "", change, i18n.Tr("cli.reason_rate_limit")); err != nil {
+		log.LogError(fmt.Sprintf("P:%s - %s", change.PackageNumber, i18n.Tr("error.hold")), err)
+		return false
+	}
+	return true
+}
+
+// quietRecipients returns the email recipients of a change that are in
+// their quiet hours, leaving out the ones that get it in a digest
+func quietRecipients(change Change, now time.Time) []string {
+	if Urgent(change) {
+		return nil
+	}
+	var quiet []string
+	for _, list := range packageRecipients(change.PackageNumber) {
+		addresses, _ := list.Parse()
+		for _, a := range addresses {
+			if change.includes(a.Address) && !heldForDigest(a.Address, change) && settings.Quiet(emailChannel, a.Address, now) {
+				quiet = append(quiet, a.Address)
+			}
+		}
+	}
+	return quiet
+}
+
+// holdForQuietHours holds the change of a channel in its quiet hours and
+// tells whether it was held
+func holdForQuietHours(n Notifier, change Change, now time.Time) (bool, error) {
+	if n.Name() == emailChannel || Urgent(change) || !settings.Quiet(n.Name(), "", now) {
+		return false, nil
+	}
+	return true, hold(n.Name(), "", change, i18n.Tr("cli.reason_quiet_hours"))
+}
+
+// FlushHeld notifies the held changes whose quiet hours are over or that
+// fit within the rate limits again
+func FlushHeld(now time.Time) {
+	held, err := caching.GetHeld()
+	if err != nil {
+		log.LogError(i18n.Tr("error.read_held"), err)
+		return
+	}
+	for _, h := range held {
+		current, err := caching.GetPackage(h.Code)
+		if err != nil {
+			log.LogError(fmt.Sprintf("P:%s - %s", h.Code, i18n.Tr("error.read_package")), err)
+			continue
+		}
+		if current == nil {
+			caching.Release(h)
+			continue
+		}
+		change := Change{PackageNumber: h.Code, Current: *current, Diff: h.Diff, Event: EventType(h.Event), Channels: h.Channels, PriorityOverride: status.Priority(h.Priority)}
+		if !flush(h, change, now) {
+			continue
+		}
+		if err = caching.Release(h); err != nil {
+			log.LogError(fmt.Sprintf("P:%s - %s", h.Code, i18n.Tr("error.release_held")), err)
+		}
+	}
+}
+
+// flush delivers a held change and tells whether it can be released
+func flush(h caching.HeldNotification, change Change, now time.Time) bool {
+	if packageMuted(h.Code, now) {
+		log.LogPackage(h.Code, i18n.Tr("cli.held_muted"))
+		return true
+	}
+	switch {
+	case h.Channel == "":
+		if rateLimited(h.Code, now) {
+			return false
+		}
+		recordSent(h.Code, now)
+		if failed := notifyEach(change); !failed.Empty() {
+			log.LogPackage(h.Code, i18n.Tr("cli.retry_later", strings.Join(failed.Channels, ", ")))
+			if err := caching.AddPending(h.Code, caching.PendingNotification{Channels: failed.Channels, Recipients: failed.Recipients, Diff: h.Diff, Event: h.Event, Priority: h.Priority}); err != nil {
+				log.LogError(fmt.Sprintf("P:%s - %s", h.Code, i18n.Tr("error.save_pending")), err)
+				return false
+			}
+		}
+		return true
+	case settings.Quiet(h.Channel, h.Recipient, now):
+		return false
+	}
+	n, found := findNotifier(h.Channel)
+	if !found {
+		log.LogPackage(h.Code, i18n.Tr("cli.held_unknown", h.Channel))
+		return true
+	}
+	var err error
+	if e, ok := n.(*EmailNotifier); ok && h.Recipient != "" {
+		err = sendTo(change, e.Sender, func(address string) bool {
+			return strings.EqualFold(address, h.Recipient)
+		})
+	} else {
+		err = n.Notify(change)
+	}
+	if err != nil && err != ErrNoRecipients {
+		log.LogError(fmt.Sprintf("P:%s - %s", h.Code, i18n.Tr("error.held_failed", h.Channel)), err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package notifications
+
+import (
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/calendar"
+	"github.com/eljuanchosf/gocafier/settings"
+)
+
+// PackageInfo describes a package, with the metadata of the config file and
+// the one set from the command line
+type PackageInfo struct {
+	Label string
+	Notes string
+	Owner string
+	// Tags are the ones of the config file, the rules and the command line
+	Tags []string
+	// Created and ExpectedDelivery are zero when unknown
+	Created          time.Time
+	ExpectedDelivery time.Time
+	Archived         bool
+}
+
+// Info returns the metadata of a package. The values set from the command
+// line win over the ones of the config file.
+func Info(packageNumber string) (PackageInfo, error) {
+	config, _ := settings.FindPackage(packageNumber)
+	meta, err := caching.GetMeta(packageNumber)
+	if err != nil {
+		return PackageInfo{}, err
+	}
+	info := PackageInfo{
+		Label:    firstOf(meta.Label, config.Label),
+		Notes:    firstOf(meta.Notes, config.Notes),
+		Owner:    firstOf(meta.Owner, config.Owner),
+		Archived: meta.Archived,
+	}
+	info.Tags, _ = caching.AddTags(append([]string{}, config.Tags...), meta.Tags...)
+	// The dates are validated with the config file and the command line
+	info.Created, _ = time.Parse(calendar.DateLayout, firstOf(meta.Created, config.Created))
+	info.ExpectedDelivery, _ = time.Parse(calendar.DateLayout, firstOf(meta.ExpectedDelivery, config.ExpectedDelivery))
+	return info, nil
+}
+
+// HasTag tells whether the package has a tag
+func (info PackageInfo) HasTag(tag string) bool {
+	for _, t := range info.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package notifications
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	"github.com/eljuanchosf/gocafier/links"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+)
+
+// linkSecret signs the mute and unsubscribe links of the emails
+var linkSecret string
+
+// SetLinkSecret sets the secret that signs the mute and unsubscribe links.
+// The emails have the links when links.base_url is also set.
+func SetLinkSecret(secret string) {
+	linkSecret = secret
+}
+
+// personalLinks tells whether the emails have mute and unsubscribe links,
+// which makes each recipient get their own copy
+func personalLinks() bool {
+	return linkSecret != "" && settings.Values.Links.BaseURL != ""
+}
+
+// linkURLs returns the mute and unsubscribe links of a package for a
+// recipient. They are empty when the links are disabled.
+func linkURLs(packageNumber string, recipient string) (mute string, unsubscribe string) {
+	if recipient == "" || !personalLinks() {
+		return "", ""
+	}
+	baseURL := settings.Values.Links.BaseURL
+	// The duration was validated with the config file
+	duration, _ := settings.Values.Links.MuteDuration()
+	mute = links.Link{Action: links.Mute, Package: packageNumber, Recipient: recipient, For: duration}.URL(baseURL, linkSecret)
+	unsubscribe = links.Link{Action: links.Unsubscribe, Package: packageNumber, Recipient: recipient}.URL(baseURL, linkSecret)
+	return mute, unsubscribe
+}
+
+// packageMuted tells whether a package is muted for everyone. Its
+// notifications are dropped, but it is still polled.
+func packageMuted(packageNumber string, now time.Time) bool {
+	mutes, err := caching.GetMutes(packageNumber)
+	if err != nil {
+		log.LogError(fmt.Sprintf("P:%s - %s", packageNumber, i18n.Tr("error.read_mutes")), err)
+		return false
+	}
+	return mutes.PackageMuted(now)
+}
+
+// recipientMuted tells whether a package is muted for an email address
+func recipientMuted(packageNumber string, address string, now time.Time) bool {
+	mutes, err := caching.GetMutes(packageNumber)
+	if err != nil {
+		log.LogError(fmt.Sprintf("P:%s - %s", packageNumber, i18n.Tr("error.read_mutes")), err)
+		return false
+	}
+	return mutes.Muted(address, now)
+}
@@ -1,62 +1,310 @@
 package notifications
 
 import (
-	"bytes"
+	"crypto/rand"
 	"fmt"
+	"net/mail"
+	"sort"
 	"strings"
-	"text/template"
+	"time"
 
 	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
 	log "github.com/eljuanchosf/gocafier/logging"
 	"github.com/eljuanchosf/gocafier/settings"
 	"gopkg.in/gomail.v2"
 )
 
-func loadBodyTemplate(packageNumber string, packageDetail caching.OcaPackageDetail, diff []caching.DetailLog) string {
-	var fullBody bytes.Buffer
+//Send sends the email notification through the given sender to the
+//recipients that take it right now, leaving out the ones that get it in a
+//digest or later, after their quiet hours
+func Send(change Change, sender gomail.Sender) error {
+	now := time.Now()
+	return sendTo(change, sender, func(address string) bool {
+		return !heldForDigest(address, change) && (Urgent(change) || !settings.Quiet(emailChannel, address, now))
+	})
+}
+
+//sendTo sends the email notification to the recipients accepted by keep,
+//leaving out the ones that muted the package. Recipients with a different
+//locale get their own copy of the message, and so does every recipient when
+//the emails have mute and unsubscribe links. A failing message does not
+//stop the others; the recipients that did not get it are returned in a
+//RecipientsError, so that only they are retried.
+func sendTo(change Change, sender gomail.Sender, keep func(address string) bool) error {
+	packageNumber := change.PackageNumber
+	now := time.Now()
 
-	type emailData struct {
-		PackageNumber string
-		From          string
-		Movements     []caching.DetailLog
+	log.LogPackage(packageNumber, i18n.Tr("cli.sending"))
+	from, err := mail.ParseAddress(settings.Values.Email.From)
+	if err != nil {
+		return err
+	}
+	fields := packageRecipients(packageNumber)
+	if IsException(change) {
+		fields["To"] = append(append(settings.AddressList{}, fields["To"]...), settings.Values.Escalation.Recipients...)
+	}
+	for field, list := range fields {
+		fields[field] = filterAddresses(list, func(address string) bool {
+			return change.includes(address) && keep(address) && !recipientMuted(packageNumber, address, now)
+		})
+	}
+	groups, locales, err := groupByLocale(fields)
+	if err != nil {
+		return err
+	}
+	if len(locales) == 0 {
+		log.LogPackage(packageNumber, i18n.Tr("cli.no_recipients"))
+		return ErrNoRecipients
 	}
+	failed := &RecipientsError{}
+	for _, locale := range locales {
+		groups[locale]["Reply-To"] = settings.Values.Email.ReplyTo
+		if !personalLinks() {
+			if err := sendLocalized(change, sender, from, locale, groups[locale], ""); err != nil {
+				failed.add(groups[locale], err)
+			}
+			continue
+		}
+		for _, field := range []string{"To", "Cc", "Bcc"} {
+			addresses, err := groups[locale][field].Parse()
+			if err != nil {
+				return err
+			}
+			for _, address := range addresses {
+				recipients := map[string]settings.AddressList{field: {address.String()}, "Reply-To": settings.Values.Email.ReplyTo}
+				if err := sendLocalized(change, sender, from, locale, recipients, address.Address); err != nil {
+					failed.add(map[string]settings.AddressList{field: {address.String()}}, err)
+				}
+			}
+		}
+	}
+	if failed.Err != nil {
+		return failed
+	}
+	log.LogPackage(packageNumber, i18n.Tr("cli.sent"))
+	return nil
+}
 
-	originDetails := packageDetail.Data[0].Detail[0]
+// add records the recipients of a message that could not be sent
+func (e *RecipientsError) add(recipients map[string]settings.AddressList, err error) {
+	e.Err = err
+	for _, field := range []string{"To", "Cc", "Bcc"} {
+		addresses, _ := recipients[field].Parse()
+		for _, address := range addresses {
+			e.Recipients = append(e.Recipients, address.Address)
+		}
+	}
+}
 
-	var packageData emailData
-	packageData.PackageNumber = packageNumber
-	packageData.From = fmt.Sprintf("%s %s, %s, %s",
-		strings.TrimSpace(originDetails.DomicilioRetiro),
-		strings.TrimSpace(originDetails.NumeroRetiro),
-		strings.TrimSpace(originDetails.LocalidadRetiro),
-		strings.TrimSpace(originDetails.PciaRetiro))
+// sendLocalized sends a message in a locale. A message for a single
+// recipient has their mute and unsubscribe links.
+func sendLocalized(change Change, sender gomail.Sender, from *mail.Address, locale string, recipients map[string]settings.AddressList, recipient string) error {
+	packageNumber := change.PackageNumber
+	m := gomail.NewMessage()
+	m.SetAddressHeader("From", from.Address, from.Name)
+	for field, list := range recipients {
+		if err := setAddressHeader(m, field, list); err != nil {
+			return err
+		}
+	}
+	subject, htmlBody, textBody, err := Render(change, locale, recipient)
+	if err != nil {
+		return err
+	}
+	m.SetHeader("Subject", subject)
+	if _, unsubscribe := linkURLs(packageNumber, recipient); unsubscribe != "" {
+		m.SetHeader("List-Unsubscribe", "<"+unsubscribe+">")
+		m.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	if IsException(change) {
+		m.SetHeader("X-Priority", "1 (Highest)")
+		m.SetHeader("Importance", "High")
+	}
 
-	packageData.Movements = diff
-	t, _ := template.ParseFiles("email-template.html")
-	t.Execute(&fullBody, packageData)
-	return fullBody.String()
-}
+	// Each locale has its own thread, as the recipients never see the
+	// others, and so does each recipient when they get their own copy
+	threadKey := packageNumber
+	if recipient != "" {
+		threadKey = packageNumber + "/" + strings.ToLower(recipient)
+	} else if locale != settings.LocaleFor("") {
+		threadKey = packageNumber + "/" + locale
+	}
+	thread, err := caching.GetThread(threadKey)
+	if err != nil {
+		return err
+	}
+	messageID := newMessageID(packageNumber, from.Address)
+	m.SetHeader("Message-ID", messageID)
+	if thread != nil {
+		m.SetHeader("In-Reply-To", thread.Last)
+		references := thread.Root
+		if thread.Last != thread.Root {
+			references += " " + thread.Last
+		}
+		m.SetHeader("References", references)
+	} else {
+		thread = &caching.Thread{Root: messageID}
+	}
+	m.SetBody("text/plain", textBody)
+	m.AddAlternative("text/html", htmlBody)
 
-//Send sends the email notification
-func Send(currentData caching.OcaPackageDetail, diff []caching.DetailLog, smtpUser string, smtpPassword string) error {
-	packageNumber := currentData.Data[0].Code
+	if err := gomail.Send(sender, m); err != nil {
+		return err
+	}
 
-	if diff == nil {
-		diff = currentData.Data[0].Log
+	// The message is already sent, so a failure here must not trigger a retry
+	thread.Last = messageID
+	if err = caching.SaveThread(threadKey, *thread); err != nil {
+		log.LogError(fmt.Sprintf("P:%s - %s", packageNumber, i18n.Tr("error.save_thread")), err)
 	}
+	return nil
+}
 
-	log.LogPackage(packageNumber, "Sending notification...")
+// SendDigest emails a digest to a single recipient
+func SendDigest(d Digest, to *mail.Address, sender gomail.Sender) error {
+	from, err := mail.ParseAddress(settings.Values.Email.From)
+	if err != nil {
+		return err
+	}
+	subject, htmlBody, textBody, err := RenderDigest(d, settings.LocaleFor(to.Address))
+	if err != nil {
+		return err
+	}
 	m := gomail.NewMessage()
-	m.SetHeader("From", settings.Values.Email.From)
-	m.SetHeader("To", settings.Values.Email.To)
-	m.SetHeader("Subject", fmt.Sprintf(settings.Values.Email.Subject, packageNumber))
-	m.SetBody("text/html", loadBodyTemplate(packageNumber, currentData, diff))
-
-	d := gomail.NewPlainDialer(settings.Values.SMTP.Server, settings.Values.SMTP.Port, smtpUser, smtpPassword)
-	if err := d.DialAndSend(m); err != nil {
+	m.SetAddressHeader("From", from.Address, from.Name)
+	m.SetAddressHeader("To", to.Address, to.Name)
+	if err = setAddressHeader(m, "Reply-To", settings.Values.Email.ReplyTo); err != nil {
+		return err
+	}
+	m.SetHeader("Subject", subject)
+	m.SetHeader("Message-ID", newMessageID("digest", from.Address))
+	m.SetBody("text/plain", textBody)
+	m.AddAlternative("text/html", htmlBody)
+	if err = gomail.Send(sender, m); err != nil {
 		return err
 	}
+	log.LogStd(i18n.Tr("cli.digest_sent_to", to.Address), true)
+	return nil
+}
+
+// packageRecipients returns the To, Cc and Bcc addresses of the emails of a package
+func packageRecipients(packageNumber string) map[string]settings.AddressList {
+	to := settings.Values.Email.To
+	if p, found := settings.FindPackage(packageNumber); found {
+		to = append(append(settings.AddressList{}, to...), p.Recipients...)
+	}
+	return map[string]settings.AddressList{
+		"To":  to,
+		"Cc":  settings.Values.Email.Cc,
+		"Bcc": settings.Values.Email.Bcc,
+	}
+}
+
+// receives tells whether an address gets the emails of a package
+func receives(address string, packageNumber string) bool {
+	for _, list := range packageRecipients(packageNumber) {
+		addresses, _ := list.Parse()
+		for _, a := range addresses {
+			if strings.EqualFold(a.Address, address) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// digestRecipients returns the recipients of a package that are in digest
+// mode. With an empty package number, the ones of every package are returned.
+func digestRecipients(packageNumber string) []*mail.Address {
+	packageNumbers := []string{packageNumber}
+	if packageNumber == "" {
+		packageNumbers = settings.PackageNumbers()
+	}
+	var recipients []*mail.Address
+	seen := make(map[string]bool)
+	for _, number := range packageNumbers {
+		for _, field := range []string{"To", "Cc", "Bcc"} {
+			addresses, _ := packageRecipients(number)[field].Parse()
+			for _, a := range addresses {
+				key := strings.ToLower(a.Address)
+				if !seen[key] && settings.Values.Digest.HasRecipient(a.Address) {
+					seen[key] = true
+					recipients = append(recipients, a)
+				}
+			}
+		}
+	}
+	return recipients
+}
+
+// heldForDigest tells whether a recipient gets the change in a digest only
+func heldForDigest(address string, change Change) bool {
+	return !Immediate(change) && settings.Values.Digest.HasRecipient(address)
+}
+
+// filterAddresses returns the addresses of a list accepted by keep
+func filterAddresses(list settings.AddressList, keep func(address string) bool) settings.AddressList {
+	var filtered settings.AddressList
+	for _, raw := range list {
+		address, err := mail.ParseAddress(raw)
+		if err == nil && !keep(address.Address) {
+			continue
+		}
+		filtered = append(filtered, raw)
+	}
+	return filtered
+}
+
+// groupByLocale splits the recipients of each header by their locale. The
+// locales are returned in a stable order, the default one first.
+func groupByLocale(fields map[string]settings.AddressList) (map[string]map[string]settings.AddressList, []string, error) {
+	groups := make(map[string]map[string]settings.AddressList)
+	var locales []string
+	defaultLocale := settings.LocaleFor("")
+	for _, field := range []string{"To", "Cc", "Bcc"} {
+		addresses, err := fields[field].Parse()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, address := range addresses {
+			locale := settings.LocaleFor(address.Address)
+			if _, ok := groups[locale]; !ok {
+				groups[locale] = make(map[string]settings.AddressList)
+				locales = append(locales, locale)
+			}
+			groups[locale][field] = append(groups[locale][field], address.String())
+		}
+	}
+	sort.SliceStable(locales, func(i, j int) bool {
+		return locales[i] == defaultLocale && locales[j] != defaultLocale
+	})
+	return groups, locales, nil
+}
+
+// newMessageID returns a unique Message-ID in the domain of the sender
+func newMessageID(packageNumber string, from string) string {
+	domain := "gocafier.local"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	random := make([]byte, 8)
+	rand.Read(random)
+	return fmt.Sprintf("<gocafier.%s.%d.%x@%s>", packageNumber, time.Now().UnixNano(), random, domain)
+}
 
-	log.LogPackage(packageNumber, "Notification sent")
+func setAddressHeader(m *gomail.Message, field string, list settings.AddressList) error {
+	addresses, err := list.Parse()
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+	var values []string
+	for _, address := range addresses {
+		values = append(values, m.FormatAddress(address.Address, address.Name))
+	}
+	m.SetHeader(field, values...)
 	return nil
 }
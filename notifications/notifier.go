@@ -0,0 +1,336 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+	"github.com/eljuanchosf/gocafier/status"
+	"gopkg.in/gomail.v2"
+)
+
+// EventType classifies a change, so that each kind can be notified differently
+type EventType string
+
+// Event types
+const (
+	EventFirstSeen      EventType = "first_seen"
+	EventNewMovement    EventType = "new_movement"
+	EventOutForDelivery EventType = "out_for_delivery"
+	EventReadyForPickup EventType = "ready_for_pickup"
+	EventPickupReminder EventType = "pickup_reminder"
+	EventDelivered      EventType = "delivered"
+	EventStuck          EventType = "stuck"
+	EventSLAWarning     EventType = "sla_warning"
+	EventSLABreach      EventType = "sla_breach"
+	EventError          EventType = "error"
+)
+
+// EventTypes lists every event type
+var EventTypes = []EventType{EventFirstSeen, EventNewMovement, EventOutForDelivery, EventReadyForPickup, EventPickupReminder, EventDelivered, EventStuck, EventSLAWarning, EventSLABreach, EventError}
+
+// Change describes an update detected on a package
+type Change struct {
+	PackageNumber string
+	Current       caching.OcaPackageDetail
+	// Diff holds the new movements. It is nil the first time a package is seen.
+	Diff []caching.DetailLog
+	// Event overrides the event type derived from the package status
+	Event EventType
+	// Channels limits the notifiers of the change. Nil means every notifier.
+	Channels []string
+	// Recipients limits the email recipients of the change, when retrying
+	// the ones that did not get it. Nil means every recipient.
+	Recipients []string
+	// PriorityOverride replaces the priority derived from the change when set
+	PriorityOverride status.Priority
+	// Test marks the changes of test-notify. Notifiers must not leave state
+	// behind for them, like retained MQTT messages.
+	Test bool
+}
+
+// Type returns the event type of the change
+func (c Change) Type() EventType {
+	if c.Event != "" {
+		return c.Event
+	}
+	if c.Diff == nil {
+		return EventFirstSeen
+	}
+	switch status.Of(c.Current) {
+	case status.OutForDelivery:
+		return EventOutForDelivery
+	case status.AtBranch:
+		return EventReadyForPickup
+	case status.Delivered:
+		return EventDelivered
+	case status.DeliveryFailed, status.Returned:
+		return EventError
+	}
+	return EventNewMovement
+}
+
+// includes tells whether an email recipient gets the change
+func (c Change) includes(address string) bool {
+	if c.Recipients == nil {
+		return true
+	}
+	for _, recipient := range c.Recipients {
+		if strings.EqualFold(recipient, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// Movements returns the movements to notify about
+func (c Change) Movements() []caching.DetailLog {
+	if c.Diff == nil {
+		return c.Current.Data[0].Log
+	}
+	return c.Diff
+}
+
+// Notifier delivers a change through a notification channel
+type Notifier interface {
+	Name() string
+	Notify(change Change) error
+}
+
+// ErrNoRecipients is returned by notifiers that had nobody to deliver a
+// change to, like Slack without subscribers for the package. It is not a
+// failure, so the change is not retried.
+var ErrNoRecipients = errors.New("no recipients")
+
+// RecipientsError is returned by the email notifier when some recipients
+// did not get a change, so that only they are retried
+type RecipientsError struct {
+	Recipients []string
+	Err        error
+}
+
+func (e *RecipientsError) Error() string {
+	return fmt.Sprintf("could not email %s: %s", strings.Join(e.Recipients, ", "), e.Err)
+}
+
+// Failures lists the notifiers that failed to deliver a change and, for
+// email, the recipients that did not get it. Nil recipients with a failed
+// email notifier means that none of them got it.
+type Failures struct {
+	Channels   []string
+	Recipients []string
+}
+
+// Empty tells whether every notifier delivered the change
+func (f Failures) Empty() bool {
+	return len(f.Channels) == 0
+}
+
+// add records a failed notifier
+func (f *Failures) add(name string, recipients []string) {
+	f.Channels = append(f.Channels, name)
+	if name == emailChannel {
+		f.Recipients = recipients
+	}
+}
+
+var notifiers []Notifier
+
+// Register adds a notifier to the ones used by NotifyAll
+func Register(n Notifier) {
+	notifiers = append(notifiers, n)
+}
+
+// NotifyAll delivers the change through every registered notifier.
+// A failing notifier does not stop the others; the names of the ones
+// that failed are returned so they can be retried. Changes over the rate
+// limits are held and merged with the next ones instead.
+func NotifyAll(change Change) Failures {
+	now := time.Now()
+	if packageMuted(change.PackageNumber, now) {
+		log.LogPackage(change.PackageNumber, i18n.Tr("cli.muted_skip"))
+		return Failures{}
+	}
+	if !Urgent(change) && holdForRateLimit(change, now) {
+		return Failures{}
+	}
+	recordSent(change.PackageNumber, now)
+	return notifyEach(change)
+}
+
+func notifyEach(change Change) Failures {
+	var failed Failures
+	for _, n := range notifiers {
+		if ok, recipients := notify(n, change); !ok {
+			failed.add(n.Name(), recipients)
+		}
+	}
+	return failed
+}
+
+// HasNotifier tells whether a notifier with the given name is registered
+func HasNotifier(name string) bool {
+	_, found := findNotifier(name)
+	return found
+}
+
+// Retry delivers the change through the named notifiers only, and by email
+// to the recipients of the change only, and returns the ones that failed again
+func Retry(change Change, names []string) Failures {
+	if packageMuted(change.PackageNumber, time.Now()) {
+		log.LogPackage(change.PackageNumber, i18n.Tr("cli.retry_muted"))
+		return Failures{}
+	}
+	var failed Failures
+	for _, name := range names {
+		found := false
+		for _, n := range notifiers {
+			if n.Name() == name {
+				found = true
+				if ok, recipients := notify(n, change); !ok {
+					failed.add(name, recipients)
+				}
+			}
+		}
+		if !found {
+			log.LogPackage(change.PackageNumber, i18n.Tr("cli.retry_unknown", name))
+		}
+	}
+	return failed
+}
+
+// notify delivers the change through a notifier and tells whether it
+// succeeded. When only some email recipients failed, they are returned too.
+func notify(n Notifier, change Change) (bool, []string) {
+	if change.Channels != nil && !containsString(change.Channels, n.Name()) {
+		return true, nil
+	}
+	if settings.Values.Escalation.HasChannel(n.Name()) && !IsException(change) {
+		return true, nil
+	}
+	held, err := queueForDigest(n, change)
+	if err == nil && !held {
+		held, err = holdForQuietHours(n, change, time.Now())
+	}
+	if err == nil && !held {
+		err = n.Notify(change)
+	}
+	if err != nil && err != ErrNoRecipients {
+		log.LogError(fmt.Sprintf("P:%s - %s", change.PackageNumber, i18n.Tr("error.notify_failed", n.Name())), err)
+		var partial *RecipientsError
+		if errors.As(err, &partial) {
+			return false, partial.Recipients
+		}
+		return false, change.Recipients
+	}
+	return true, nil
+}
+
+// CycleCloser is implemented by notifiers that keep resources open
+// during a poll cycle
+type CycleCloser interface {
+	CloseCycle() error
+}
+
+// EndCycle releases the resources held by notifiers during a poll cycle
+func EndCycle() {
+	for _, n := range notifiers {
+		if c, ok := n.(CycleCloser); ok {
+			if err := c.CloseCycle(); err != nil {
+				log.LogError(i18n.Tr("error.close_cycle", n.Name()), err)
+			}
+		}
+	}
+}
+
+// EmailNotifier sends the change by email to the configured recipient
+type EmailNotifier struct {
+	Sender gomail.Sender
+}
+
+// Name returns the channel name
+func (e *EmailNotifier) Name() string {
+	return emailChannel
+}
+
+// Notify emails the change if the package comes from the config file.
+// Recipients in digest mode get it in their next digest instead, unless
+// the change is urgent.
+func (e *EmailNotifier) Notify(change Change) error {
+	if !settings.HasPackage(change.PackageNumber) {
+		return nil
+	}
+	queued := make(map[string]bool)
+	for _, address := range digestRecipients(change.PackageNumber) {
+		if !change.includes(address.Address) {
+			continue
+		}
+		key := emailDigestKey(address.Address)
+		if queued[key] {
+			continue
+		}
+		queued[key] = true
+		if err := caching.AddToDigest(key, change.PackageNumber, change.Movements()); err != nil {
+			return err
+		}
+		if !Immediate(change) {
+			log.LogPackage(change.PackageNumber, i18n.Tr("cli.digest_queued", key))
+		}
+	}
+	now := time.Now()
+	for _, address := range quietRecipients(change, now) {
+		if err := hold(emailChannel, address, change, i18n.Tr("cli.reason_quiet_hours")); err != nil {
+			return err
+		}
+	}
+	return Send(change, e.Sender)
+}
+
+// NotifyDigest emails each recipient of the digest a summary of the
+// packages they receive. A failing recipient does not stop the others, and
+// the digest is only retried when every recipient failed, so the ones
+// already emailed do not get it twice.
+func (e *EmailNotifier) NotifyDigest(d Digest) error {
+	now := time.Now()
+	var failed []string
+	sent := 0
+	for _, address := range digestRecipients("") {
+		// Each address with its own schedule has its own digest
+		if emailDigestKey(address.Address) != emailDigestKey(d.Recipient) {
+			continue
+		}
+		personal := d.Filter(func(packageNumber string) bool {
+			return receives(address.Address, packageNumber) && !recipientMuted(packageNumber, address.Address, now)
+		})
+		if personal.Empty() {
+			continue
+		}
+		if err := SendDigest(personal, address, e.Sender); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", address.Address, err))
+			continue
+		}
+		sent++
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("email digest failed for %s", strings.Join(failed, "; "))
+	if sent == 0 {
+		return err
+	}
+	log.LogError(i18n.Tr("error.digest_not_retried", emailChannel), err)
+	return nil
+}
+
+// CloseCycle closes the connection reused during the poll cycle, if the sender keeps one
+func (e *EmailNotifier) CloseCycle() error {
+	if c, ok := e.Sender.(CycleCloser); ok {
+		return c.CloseCycle()
+	}
+	return nil
+}
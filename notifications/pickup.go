@@ -0,0 +1,104 @@
+package notifications
+
+import (
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/calendar"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+// BranchAddress returns the address of the branch where the package is
+// picked up, or an empty string when OCA does not give it
+func BranchAddress(current caching.OcaPackageDetail) string {
+	if len(current.Data) == 0 || len(current.Data[0].Detail) == 0 {
+		return ""
+	}
+	d := current.Data[0].Detail[0]
+	street := strings.TrimSpace(strings.TrimSpace(d.DomicilioRetiro) + " " + strings.TrimSpace(d.NumeroRetiro))
+	city := strings.TrimSpace(d.LocalidadRetiro)
+	if postalCode := strings.TrimSpace(d.CodigoPostalRetiro); postalCode != "" {
+		city = strings.TrimSpace(city + " (" + postalCode + ")")
+	}
+	var parts []string
+	for _, part := range []string{street, city, strings.TrimSpace(d.PciaRetiro)} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// PickupDeadline returns the last day to pick up a package waiting at a
+// branch, before OCA returns it
+func PickupDeadline(current caching.OcaPackageDetail) (time.Time, bool) {
+	arrived, ok := arrival(current)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, ok := arrived.Time()
+	if !ok {
+		return time.Time{}, false
+	}
+	return calendar.AddBusinessDays(t, settings.Values.Pickup.Hold()), true
+}
+
+// PickupReminder tells whether a package waiting at a branch has to be
+// reminded today, and returns the change to notify. Reminders are sent once
+// per business day, from the day after the arrival until the deadline.
+func PickupReminder(packageNumber string, current caching.OcaPackageDetail, now time.Time) (Change, bool, error) {
+	change := Change{PackageNumber: packageNumber, Current: current, Diff: []caching.DetailLog{}, Event: EventPickupReminder}
+	arrived, ok := arrival(current)
+	if !ok {
+		return change, false, nil
+	}
+	deadline, ok := PickupDeadline(current)
+	if !ok {
+		return change, false, nil
+	}
+	pickup, err := caching.GetPickup(packageNumber)
+	if err != nil {
+		return change, false, err
+	}
+	if pickup == nil || pickup.Arrival != arrived {
+		// The arrival itself is notified as ready_for_pickup
+		return change, false, caching.SavePickup(packageNumber, caching.Pickup{Arrival: arrived, LastReminder: now})
+	}
+	location := settings.Location()
+	if location == nil {
+		location = time.Local
+	}
+	local := now.In(location)
+	minute, _ := settings.Values.Pickup.ReminderMinute()
+	switch {
+	case pickup.LastReminder.In(location).Format(calendar.DateLayout) == local.Format(calendar.DateLayout),
+		!calendar.IsBusinessDay(local),
+		local.Hour()*60+local.Minute() < minute,
+		calendar.BusinessDays(deadline, local) > 0:
+		return change, false, nil
+	}
+	log.LogPackage(packageNumber, i18n.Tr("cli.pickup_reminder", i18n.FormatDate(i18n.Locale(), deadline)))
+	pickup.LastReminder = now
+	return change, true, caching.SavePickup(packageNumber, *pickup)
+}
+
+// arrival returns the movement that put the package at the branch: the
+// first of the movements at the branch it is still in
+func arrival(current caching.OcaPackageDetail) (caching.DetailLog, bool) {
+	if len(current.Data) == 0 {
+		return caching.DetailLog{}, false
+	}
+	movements := current.Data[0].Log
+	i := len(movements)
+	for i > 0 && status.Classify(movements[i-1].Description) == status.AtBranch {
+		i--
+	}
+	if i == len(movements) {
+		return caching.DetailLog{}, false
+	}
+	return movements[i], true
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package notifications
+
+import "os/exec"
+
+// killGroup does nothing without process groups. The timeout only kills
+// sendmail, and sendmailWaitDelay stops waiting for its children
+func killGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package notifications
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killGroup starts sendmail in its own process group and makes the timeout
+// kill the whole group, so the processes it delivers through stop with it
+func killGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,99 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+	"gopkg.in/gomail.v2"
+)
+
+// Email transports
+const (
+	TransportSMTP     = "smtp"
+	TransportSendmail = "sendmail"
+)
+
+const (
+	defaultSendmailPath = "/usr/sbin/sendmail"
+	// sendmailWaitDelay is how long a timed out sendmail may keep its
+	// output open, e.g. through a child that left its process group
+	sendmailWaitDelay = 2 * time.Second
+)
+
+// NewSender returns the gomail.Sender for the transport selected in the config file
+func NewSender(smtpUser string, smtpPassword string) (gomail.Sender, error) {
+	switch strings.ToLower(settings.Values.Email.Transport) {
+	case TransportSMTP, "":
+		if len(settings.Values.SMTP.Relays) > 0 {
+			return NewFailover(settings.Values.SMTP.Relays, settings.Values.SMTP.Cooldown, smtpUser, smtpPassword)
+		}
+		return NewSMTPTransport(settings.Values.SMTP.SMTPServer, smtpUser, smtpPassword)
+	case TransportSendmail:
+		return NewSendmail(settings.Values.Sendmail.Path, settings.Values.Sendmail.Args), nil
+	}
+	return nil, fmt.Errorf("unknown email.transport %q", settings.Values.Email.Transport)
+}
+
+// RequiresCredentials tells whether the selected transport needs the SMTP
+// credentials from the command line. Relays carry their own credentials.
+func RequiresCredentials() bool {
+	transport := strings.ToLower(settings.Values.Email.Transport)
+	if transport != TransportSMTP && transport != "" {
+		return false
+	}
+	smtp := settings.Values.SMTP
+	return len(smtp.Relays) == 0 && smtp.Username == "" && strings.ToLower(smtp.Auth) != AuthNone
+}
+
+// NewSendmail returns a sender that pipes messages to a sendmail compatible
+// binary. The envelope recipients are passed on the command line, since Bcc
+// recipients are not part of the message headers. Like an SMTP send, each
+// message must be handed over within sendTimeout.
+func NewSendmail(path string, args []string) gomail.SendFunc {
+	if path == "" {
+		path = defaultSendmailPath
+	}
+	if len(args) == 0 {
+		args = []string{"-i"}
+	}
+	return func(from string, to []string, msg io.WriterTo) error {
+		cmdArgs := append(append([]string{}, args...), "-f", from, "--")
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, path, append(cmdArgs, to...)...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		killGroup(cmd)
+		cmd.WaitDelay = sendmailWaitDelay
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		if err = cmd.Start(); err != nil {
+			return fmt.Errorf("could not run %s: %s", path, err)
+		}
+		_, writeErr := msg.WriteTo(stdin)
+		stdin.Close()
+		err = cmd.Wait()
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			log.LogStd(fmt.Sprintf("%s: %s", path, output), false)
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%s timed out after %s", path, sendTimeout)
+		}
+		if err != nil {
+			return fmt.Errorf("%s failed: %s: %s", path, err, strings.TrimSpace(stderr.String()))
+		}
+		if writeErr != nil {
+			return fmt.Errorf("could not write message to %s: %s", path, writeErr)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+package notifications
+
+import (
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/calendar"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+// SLA results
+const (
+	SLAOnTime     = "on_time"
+	SLALate       = "late"
+	SLAInProgress = "in_progress"
+)
+
+// SLA is the delivery promised for a package, measured in business days
+// from its first movement
+type SLA struct {
+	Days     int
+	Start    time.Time
+	Deadline time.Time
+	// Elapsed is the business days until the delivery, or until now while
+	// the package is in transit
+	Elapsed int
+	// Result is on_time, late or in_progress. Returned packages are late.
+	Result string
+}
+
+// Remaining returns the business days left before the deadline
+func (s SLA) Remaining() int {
+	return s.Days - s.Elapsed
+}
+
+// PackageSLA returns the SLA of a package. It is false when no SLA applies
+// or the dates of the movements are unknown.
+func PackageSLA(packageNumber string, current caching.OcaPackageDetail, now time.Time) (SLA, bool) {
+	var sla SLA
+	if len(current.Data) == 0 || len(current.Data[0].Log) == 0 {
+		return sla, false
+	}
+	data := current.Data[0]
+	// The Retiro fields of OCA are the pickup branch, so the origin comes from
+	// the config file
+	var origin, destination string
+	if p, found := settings.FindPackage(packageNumber); found {
+		origin = p.Origin
+	}
+	if len(data.Detail) > 0 {
+		destination = data.Detail[0].Provincia
+	}
+	sla.Days = settings.SLADays(packageNumber, data.Type, origin, destination)
+	if sla.Days <= 0 {
+		return sla, false
+	}
+	start, ok := data.Log[0].Time()
+	if !ok {
+		return sla, false
+	}
+	sla.Start = start
+	sla.Deadline = calendar.AddBusinessDays(start, sla.Days)
+
+	packageStatus := status.Of(current)
+	end := now
+	if packageStatus.IsFinal() {
+		last, _ := current.LastMovement()
+		if end, ok = last.Time(); !ok {
+			return sla, false
+		}
+	}
+	sla.Elapsed = calendar.BusinessDays(start, end)
+	switch {
+	case packageStatus == status.Returned || sla.Elapsed > sla.Days:
+		sla.Result = SLALate
+	case packageStatus == status.Delivered:
+		sla.Result = SLAOnTime
+	default:
+		sla.Result = SLAInProgress
+	}
+	return sla, true
+}
+
+// CheckSLA tells whether a package in transit has to be warned about its
+// deadline or alerted for missing it, and returns the change to notify.
+// Each notification is sent once per package.
+func CheckSLA(packageNumber string, current caching.OcaPackageDetail, now time.Time) (Change, bool, error) {
+	change := Change{PackageNumber: packageNumber, Current: current, Diff: []caching.DetailLog{}}
+	sla, ok := PackageSLA(packageNumber, current, now)
+	if !ok || status.Of(current).IsFinal() {
+		return change, false, nil
+	}
+	alert, err := caching.GetSLAAlert(packageNumber)
+	if err != nil {
+		return change, false, err
+	}
+	switch {
+	case sla.Result == SLALate && !alert.Breached:
+		alert.Breached, alert.Warned = true, true
+		change.Event = EventSLABreach
+		log.LogPackage(packageNumber, i18n.Tr("cli.sla_breach", sla.Days))
+	case sla.Result == SLAInProgress && !alert.Warned && sla.Remaining() <= settings.Values.SLA.WarnBefore():
+		alert.Warned = true
+		change.Event = EventSLAWarning
+		log.LogPackage(packageNumber, i18n.Tr("cli.sla_warning", sla.Remaining()))
+	default:
+		return change, false, nil
+	}
+	return change, true, caching.SaveSLAAlert(packageNumber, alert)
+}
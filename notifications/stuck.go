@@ -0,0 +1,52 @@
+package notifications
+
+import (
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/calendar"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+// Stuck tells whether a package that did not move has to be alerted as
+// stuck, and returns the change to notify. The alert fires once per stall,
+// plus a single reminder when configured.
+func Stuck(packageNumber string, current caching.OcaPackageDetail, now time.Time) (Change, bool, error) {
+	change := Change{PackageNumber: packageNumber, Current: current, Diff: []caching.DetailLog{}, Event: EventStuck}
+	last, ok := current.LastMovement()
+	if !ok {
+		return change, false, nil
+	}
+	movedAt, ok := last.Time()
+	if !ok {
+		return change, false, nil
+	}
+	packageStatus := status.Of(current)
+	threshold := settings.StuckThreshold(packageNumber, packageStatus)
+	if packageStatus.IsFinal() || threshold <= 0 {
+		return change, false, nil
+	}
+	idle := calendar.BusinessDays(movedAt, now)
+	if idle < threshold {
+		return change, false, nil
+	}
+
+	stall, err := caching.GetStall(packageNumber)
+	if err != nil {
+		return change, false, err
+	}
+	switch {
+	case stall == nil || stall.Movement != last:
+		stall = &caching.Stall{Movement: last, AlertedAt: now}
+		log.LogPackage(packageNumber, i18n.Tr("cli.stuck", idle))
+	case !stall.Reminded && settings.Values.Stuck.Reminder > 0 && calendar.BusinessDays(stall.AlertedAt, now) >= settings.Values.Stuck.Reminder:
+		stall.Reminded = true
+		log.LogPackage(packageNumber, i18n.Tr("cli.stuck_reminder", idle))
+	default:
+		return change, false, nil
+	}
+	return change, true, caching.SaveStall(packageNumber, *stall)
+}
@@ -0,0 +1,477 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+//go:embed templates
+var builtinTemplates embed.FS
+
+// legacyTemplate is the HTML template that gocafier read from the working
+// directory before the templates were configurable
+const legacyTemplate = "email-template.html"
+
+// defaultSubjects are used for the events without a subject in the config file
+var defaultSubjects = map[EventType]string{
+	EventFirstSeen:      `{{.T "subject.first_seen" .Label}}`,
+	EventNewMovement:    `{{.T "subject.new_movement" .Label .LastEvent.Description}}`,
+	EventOutForDelivery: `{{.T "subject.out_for_delivery" .Label}}`,
+	EventReadyForPickup: `{{.T "subject.ready_for_pickup" .Label}}`,
+	EventPickupReminder: `{{.T "subject.pickup_reminder" .Label}}`,
+	EventDelivered:      `{{.T "subject.delivered" .Label}}`,
+	EventStuck:          `{{.T "subject.stuck" .Label}}`,
+	EventSLAWarning:     `{{.T "subject.sla_warning" .Label}}`,
+	EventSLABreach:      `{{.T "subject.sla_breach" .Label}}`,
+	EventError:          `{{.T "subject.error" .Label .LastEvent.Description}}`,
+}
+
+type eventTemplates struct {
+	html    *htmltemplate.Template
+	text    *template.Template
+	subject *template.Template
+}
+
+var templates map[EventType]eventTemplates
+var digestTemplates *eventTemplates
+
+// TimelineEntry is a movement of the package as shown in the templates
+type TimelineEntry struct {
+	caching.DetailLog
+	Status status.Status
+	// When is the date of the movement formatted for the locale
+	When string
+	// Translation is the name of the status when the locale is not Spanish,
+	// since the OCA descriptions are always in Spanish
+	Translation string
+	// New is set on the movements that triggered the notification
+	New bool
+	// Exception is set on the failed deliveries, address problems and returns
+	Exception bool
+}
+
+// emailData is the data available to the email and subject templates
+type emailData struct {
+	PackageNumber string
+	Label         string
+	Type          string
+	Event         EventType
+	Status        status.Status
+	// StatusName is the name of the status in the locale of the email
+	StatusName string
+	LastEvent  caching.DetailLog
+	// LastUpdate is the date of the last event formatted for the locale
+	LastUpdate string
+	// Deadline is the SLA deadline formatted for the locale. It is empty
+	// when the package has no SLA.
+	Deadline string
+	// Exception is set when the change has an exception to highlight
+	Exception bool
+	// Branch is the address of the pickup branch, empty when OCA does not
+	// give it. PickupUntil is the last day to pick the package up, empty
+	// unless it is at the branch.
+	Branch      string
+	PickupUntil string
+	// Notes, Owner and Tags describe the package. Created and
+	// ExpectedDelivery are formatted for the locale, and empty when unknown.
+	Notes            string
+	Owner            string
+	Tags             []string
+	Created          string
+	ExpectedDelivery string
+	// MuteURL and UnsubscribeURL silence the package for the recipient. They
+	// are empty unless the links are enabled.
+	MuteURL        string
+	UnsubscribeURL string
+	From           string
+	Locale         string
+	// Movements holds the new movements only
+	Movements []caching.DetailLog
+	Timeline  []TimelineEntry
+}
+
+// LoadTemplates parses the email and subject templates of every event type.
+// Each event uses, in order, its own template from the config file, the
+// general one from the config file, email-template.html in the working
+// directory for the HTML part, or the built-in one. The templates are
+// rendered once with sample data, so a broken template fails at startup
+// instead of producing an empty body.
+func LoadTemplates() error {
+	loaded := make(map[EventType]eventTemplates)
+	config := settings.Values.Email
+	generalHTML := config.Templates.HTML
+	if generalHTML == "" {
+		if _, err := os.Stat(legacyTemplate); err == nil {
+			log.LogStd(i18n.Tr("cli.legacy_template", legacyTemplate), true)
+			generalHTML = legacyTemplate
+		}
+	}
+	for _, event := range EventTypes {
+		eventConfig := config.Templates.Events[string(event)]
+
+		htmlSource, err := readTemplate(eventConfig.HTML, generalHTML, "templates/layout.html")
+		if err != nil {
+			return err
+		}
+		textSource, err := readTemplate(eventConfig.Text, config.Templates.Text, "templates/layout.txt")
+		if err != nil {
+			return err
+		}
+		htmlHeadlines, err := builtinTemplates.ReadFile("templates/headlines.html")
+		if err != nil {
+			return err
+		}
+		textHeadlines, err := builtinTemplates.ReadFile("templates/headlines.txt")
+		if err != nil {
+			return err
+		}
+		// "headline" points to the headline of the event, so a single
+		// layout serves every event
+		headline := fmt.Sprintf(`{{define "headline"}}{{template "headline_%s" .}}{{end}}`, event)
+
+		var t eventTemplates
+		t.html, err = htmltemplate.New(string(event)).Parse(string(htmlHeadlines) + headline + htmlSource)
+		if err != nil {
+			return fmt.Errorf("%s html template: %s", event, err)
+		}
+		t.text, err = template.New(string(event)).Parse(string(textHeadlines) + headline + textSource)
+		if err != nil {
+			return fmt.Errorf("%s text template: %s", event, err)
+		}
+		t.subject, err = template.New(string(event)).Parse(subjectSource(event))
+		if err != nil {
+			return fmt.Errorf("%s subject template: %s", event, err)
+		}
+		for _, locale := range i18n.Locales() {
+			if _, _, _, err = t.render(sampleData(event, locale)); err != nil {
+				return fmt.Errorf("%s template: %s", event, err)
+			}
+		}
+		loaded[event] = t
+	}
+	templates = loaded
+	return loadDigestTemplates()
+}
+
+// loadDigestTemplates parses the templates of the digest emails
+func loadDigestTemplates() error {
+	config := settings.Values.Email
+	htmlSource, err := readTemplate(config.Templates.Digest.HTML, "", "templates/digest.html")
+	if err != nil {
+		return err
+	}
+	textSource, err := readTemplate(config.Templates.Digest.Text, "", "templates/digest.txt")
+	if err != nil {
+		return err
+	}
+	subject := config.Subjects["digest"]
+	if subject == "" {
+		subject = `{{.T "subject.digest"}}`
+	}
+
+	var t eventTemplates
+	if t.html, err = htmltemplate.New("digest").Parse(htmlSource); err != nil {
+		return fmt.Errorf("digest html template: %s", err)
+	}
+	if t.text, err = template.New("digest").Parse(textSource); err != nil {
+		return fmt.Errorf("digest text template: %s", err)
+	}
+	if t.subject, err = template.New("digest").Parse(subject); err != nil {
+		return fmt.Errorf("digest subject template: %s", err)
+	}
+	for _, locale := range i18n.Locales() {
+		if _, _, _, err = t.render(sampleDigestData(locale)); err != nil {
+			return fmt.Errorf("digest template: %s", err)
+		}
+	}
+	digestTemplates = &t
+	return nil
+}
+
+// subjectSource returns the subject template of an event. Subjects written
+// for fmt, like "Paquete OCA %s", are still accepted.
+func subjectSource(event EventType) string {
+	subject := settings.Values.Email.Subjects[string(event)]
+	if subject == "" {
+		subject = settings.Values.Email.Subject
+	}
+	if subject == "" {
+		return defaultSubjects[event]
+	}
+	if !strings.Contains(subject, "{{") {
+		return strings.Replace(subject, "%s", "{{.PackageNumber}}", -1)
+	}
+	return subject
+}
+
+func readTemplate(eventPath string, generalPath string, builtin string) (string, error) {
+	var source []byte
+	var err error
+	switch {
+	case eventPath != "":
+		log.LogStd(i18n.Tr("cli.loading_template", eventPath), true)
+		source, err = ioutil.ReadFile(eventPath)
+	case generalPath != "":
+		log.LogStd(i18n.Tr("cli.loading_template", generalPath), true)
+		source, err = ioutil.ReadFile(generalPath)
+	default:
+		source, err = builtinTemplates.ReadFile(builtin)
+	}
+	return string(source), err
+}
+
+func (t eventTemplates) render(data interface{}) (subject string, htmlBody string, textBody string, err error) {
+	var subjectBuffer, htmlBuffer, textBuffer bytes.Buffer
+	if err = t.subject.Execute(&subjectBuffer, data); err != nil {
+		return
+	}
+	if err = t.html.Execute(&htmlBuffer, data); err != nil {
+		return
+	}
+	if err = t.text.Execute(&textBuffer, data); err != nil {
+		return
+	}
+	// Subjects are a single line, whatever the template looks like
+	subject = strings.Join(strings.Fields(subjectBuffer.String()), " ")
+	return subject, htmlBuffer.String(), textBuffer.String(), nil
+}
+
+// T returns a message of the catalog in the locale of the email
+func (d emailData) T(key string, args ...interface{}) string {
+	return i18n.T(d.Locale, key, args...)
+}
+
+// formatDate returns the date of a movement formatted for a locale, or the
+// date as given by OCA when it cannot be parsed
+func formatDate(locale string, movement caching.DetailLog) string {
+	t, ok := movement.Time()
+	if !ok {
+		return movement.Date
+	}
+	return i18n.FormatTime(locale, t, settings.Location())
+}
+
+func newTimelineEntry(locale string, movement caching.DetailLog) TimelineEntry {
+	entry := TimelineEntry{DetailLog: movement, Status: status.Classify(movement.Description), When: formatDate(locale, movement)}
+	entry.Exception = entry.Status.IsException()
+	if !strings.HasPrefix(locale, "es") && entry.Status != status.Unknown {
+		entry.Translation = entry.Status.LocalizedName(locale)
+	}
+	return entry
+}
+
+func newEmailData(change Change, locale string) emailData {
+	current := change.Current.Data[0]
+	data := emailData{
+		PackageNumber: change.PackageNumber,
+		Label:         i18n.T(locale, "email.label", change.PackageNumber),
+		Type:          current.Type,
+		Event:         change.Type(),
+		Status:        status.Of(change.Current),
+		Movements:     change.Movements(),
+		Locale:        locale,
+		Exception:     IsException(change),
+	}
+	data.StatusName = data.Status.LocalizedName(locale)
+	info, err := Info(change.PackageNumber)
+	if err != nil {
+		log.LogError(i18n.Tr("error.read_info"), err)
+	}
+	if info.Label != "" {
+		data.Label = info.Label
+	}
+	data.Notes, data.Owner, data.Tags = info.Notes, info.Owner, info.Tags
+	if !info.Created.IsZero() {
+		data.Created = i18n.FormatDate(locale, info.Created)
+	}
+	if !info.ExpectedDelivery.IsZero() {
+		data.ExpectedDelivery = i18n.FormatDate(locale, info.ExpectedDelivery)
+	}
+	data.LastEvent, _ = change.Current.LastMovement()
+	data.LastUpdate = formatDate(locale, data.LastEvent)
+	if sla, ok := PackageSLA(change.PackageNumber, change.Current, time.Now()); ok {
+		data.Deadline = i18n.FormatDate(locale, sla.Deadline)
+	}
+	data.Branch = BranchAddress(change.Current)
+	// From is the old name of Branch, still used by custom templates
+	data.From = data.Branch
+	if data.Status == status.AtBranch {
+		if until, ok := PickupDeadline(change.Current); ok {
+			data.PickupUntil = i18n.FormatDate(locale, until)
+		}
+	}
+
+	for _, movement := range current.Log {
+		entry := newTimelineEntry(locale, movement)
+		entry.New = change.Diff == nil
+		for _, d := range change.Diff {
+			if d == movement {
+				entry.New = true
+				break
+			}
+		}
+		data.Timeline = append(data.Timeline, entry)
+	}
+	return data
+}
+
+func sampleData(event EventType, locale string) emailData {
+	movements := []caching.DetailLog{
+		{Date: "01/01/2016 10:00", Description: "En tránsito"},
+		{Date: "02/01/2016 09:00", Description: "En distribución"},
+	}
+	latest := newTimelineEntry(locale, movements[1])
+	latest.New = true
+	return emailData{
+		PackageNumber:    "000000000000",
+		Label:            i18n.T(locale, "email.label", "000000000000"),
+		Type:             "paquetes",
+		Event:            event,
+		Exception:        event == EventError,
+		Status:           status.OutForDelivery,
+		StatusName:       status.OutForDelivery.LocalizedName(locale),
+		LastEvent:        movements[1],
+		LastUpdate:       latest.When,
+		Deadline:         i18n.FormatDate(locale, time.Date(2016, time.January, 5, 0, 0, 0, 0, time.UTC)),
+		Branch:           "Av. Corrientes 1234, Buenos Aires (C1043), CABA",
+		PickupUntil:      i18n.FormatDate(locale, time.Date(2016, time.January, 8, 0, 0, 0, 0, time.UTC)),
+		MuteURL:          "https://gocafier.example.com/mute",
+		UnsubscribeURL:   "https://gocafier.example.com/unsubscribe",
+		Notes:            "Regalo de cumpleaños",
+		Owner:            "Juan",
+		Tags:             []string{"regalos"},
+		Created:          i18n.FormatDate(locale, time.Date(2015, time.December, 28, 0, 0, 0, 0, time.UTC)),
+		ExpectedDelivery: i18n.FormatDate(locale, time.Date(2016, time.January, 4, 0, 0, 0, 0, time.UTC)),
+		From:             "Calle 123, Localidad, Provincia",
+		Locale:           locale,
+		Movements:        movements[1:],
+		Timeline:         []TimelineEntry{newTimelineEntry(locale, movements[0]), latest},
+	}
+}
+
+// digestData is the data available to the digest templates
+type digestData struct {
+	Locale string
+	Since  string
+	Until  string
+	// Moved are the packages with new movements
+	Moved []digestPackage
+	// Idle are the active packages that did not move
+	Idle []digestPackage
+}
+
+// digestPackage is a package as shown in the digest templates
+type digestPackage struct {
+	PackageNumber string
+	Label         string
+	Owner         string
+	Status        status.Status
+	StatusName    string
+	LastEvent     caching.DetailLog
+	LastUpdate    string
+	// Movements holds the movements since the previous digest
+	Movements []TimelineEntry
+}
+
+// T returns a message of the catalog in the locale of the digest
+func (d digestData) T(key string, args ...interface{}) string {
+	return i18n.T(d.Locale, key, args...)
+}
+
+func newDigestData(d Digest, locale string) digestData {
+	data := digestData{
+		Locale: locale,
+		Since:  i18n.FormatTime(locale, d.Since, settings.Location()),
+		Until:  i18n.FormatTime(locale, d.Until, settings.Location()),
+	}
+	for _, e := range d.Moved {
+		data.Moved = append(data.Moved, newDigestPackage(e, locale))
+	}
+	for _, e := range d.Idle {
+		data.Idle = append(data.Idle, newDigestPackage(e, locale))
+	}
+	return data
+}
+
+func newDigestPackage(e DigestEntry, locale string) digestPackage {
+	p := digestPackage{
+		PackageNumber: e.PackageNumber,
+		Label:         i18n.T(locale, "email.label", e.PackageNumber),
+		Status:        e.Status(),
+		StatusName:    e.Status().LocalizedName(locale),
+	}
+	info, err := Info(e.PackageNumber)
+	if err != nil {
+		log.LogError(i18n.Tr("error.read_info"), err)
+	}
+	if info.Label != "" {
+		p.Label = info.Label
+	}
+	p.Owner = info.Owner
+	p.LastEvent, _ = e.Current.LastMovement()
+	p.LastUpdate = formatDate(locale, p.LastEvent)
+	for _, movement := range e.Movements {
+		p.Movements = append(p.Movements, newTimelineEntry(locale, movement))
+	}
+	return p
+}
+
+func sampleDigestData(locale string) digestData {
+	now := time.Now()
+	movement := caching.DetailLog{Date: "02/01/2016 09:00", Description: "En distribución"}
+	moved := digestPackage{
+		PackageNumber: "000000000000",
+		Label:         i18n.T(locale, "email.label", "000000000000"),
+		Status:        status.OutForDelivery,
+		StatusName:    status.OutForDelivery.LocalizedName(locale),
+		LastEvent:     movement,
+		LastUpdate:    formatDate(locale, movement),
+		Movements:     []TimelineEntry{newTimelineEntry(locale, movement)},
+	}
+	idle := moved
+	idle.PackageNumber = "111111111111"
+	idle.Label = i18n.T(locale, "email.label", "111111111111")
+	idle.Movements = nil
+	return digestData{
+		Locale: locale,
+		Since:  i18n.FormatTime(locale, now.AddDate(0, 0, -1), settings.Location()),
+		Until:  i18n.FormatTime(locale, now, settings.Location()),
+		Moved:  []digestPackage{moved},
+		Idle:   []digestPackage{idle},
+	}
+}
+
+// RenderDigest returns the subject and the HTML and plain text bodies of a
+// digest email, in the given locale
+func RenderDigest(d Digest, locale string) (subject string, htmlBody string, textBody string, err error) {
+	if digestTemplates == nil {
+		return "", "", "", fmt.Errorf("digest templates are not loaded")
+	}
+	return digestTemplates.render(newDigestData(d, locale))
+}
+
+// Render returns the subject and the HTML and plain text bodies of the email
+// for a change, in the given locale. The email has the mute and unsubscribe
+// links of the recipient, when given and enabled.
+func Render(change Change, locale string, recipient string) (subject string, htmlBody string, textBody string, err error) {
+	t, ok := templates[change.Type()]
+	if !ok {
+		return "", "", "", fmt.Errorf("email templates are not loaded")
+	}
+	data := newEmailData(change, locale)
+	data.MuteURL, data.UnsubscribeURL = linkURLs(change.PackageNumber, recipient)
+	return t.render(data)
+}
@@ -0,0 +1,102 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/eljuanchosf/gocafier/caching"
+)
+
+// fixtureMovements is the last movement of the fixture package for each event
+var fixtureMovements = map[EventType]string{
+	EventFirstSeen:      "En tránsito",
+	EventNewMovement:    "En tránsito",
+	EventOutForDelivery: "En distribución",
+	EventReadyForPickup: "Disponible para retiro en sucursal",
+	EventPickupReminder: "Disponible para retiro en sucursal",
+	EventDelivered:      "Entregado",
+	EventStuck:          "En tránsito",
+	EventSLAWarning:     "En tránsito",
+	EventSLABreach:      "En tránsito",
+	EventError:          "Entrega sin éxito, domicilio inexistente",
+}
+
+// TestResult is the outcome of a test notification through a channel. Err
+// is ErrNoRecipients when the channel had nobody to deliver it to.
+type TestResult struct {
+	Channel string
+	Err     error
+}
+
+// Fixture returns made up data for a package whose last movement matches an event
+func Fixture(packageNumber string, event EventType) (caching.OcaPackageDetail, error) {
+	var p caching.OcaPackageDetail
+	fixture := map[string]interface{}{
+		"success": true,
+		"data": []map[string]interface{}{{
+			"type": "paquetes",
+			"code": packageNumber,
+			"detail": []map[string]string{{
+				"DomicilioRetiro":    "Av. Corrientes",
+				"NumeroRetiro":       "1234",
+				"LocalidadRetiro":    "Buenos Aires",
+				"PciaRetiro":         "CABA",
+				"CodigoPostalRetiro": "C1043",
+			}},
+			"log": []caching.DetailLog{
+				{Date: "01/01/2016 10:00", Description: "Ingresado en sucursal de origen"},
+				{Date: "02/01/2016 09:00", Description: fixtureMovements[event]},
+			},
+		}},
+	}
+	data, err := json.Marshal(fixture)
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal(data, &p)
+	return p, err
+}
+
+// TestChange returns a change to test the event with, using the cached data
+// of the package when there is some, or fixture data otherwise
+func TestChange(packageNumber string, event EventType) (Change, error) {
+	change := Change{PackageNumber: packageNumber, Event: event, Test: true}
+	cached, err := caching.GetPackage(packageNumber)
+	if err != nil {
+		return change, err
+	}
+	if cached != nil && len(cached.Data) > 0 && len(cached.Data[0].Log) > 0 {
+		change.Current = *cached
+	} else if change.Current, err = Fixture(packageNumber, event); err != nil {
+		return change, err
+	}
+	if event != EventFirstSeen {
+		last, _ := change.Current.LastMovement()
+		change.Diff = []caching.DetailLog{last}
+	}
+	return change, nil
+}
+
+// Test sends a change through the registered notifiers, or only through the
+// named one when channel is not empty. Digests, quiet hours and rate limits
+// are skipped, and emails go to every configured recipient.
+func Test(change Change, channel string) ([]TestResult, error) {
+	var results []TestResult
+	for _, n := range notifiers {
+		if channel != "" && n.Name() != channel {
+			continue
+		}
+		var err error
+		if e, ok := n.(*EmailNotifier); ok {
+			err = sendTo(change, e.Sender, func(string) bool { return true })
+		} else {
+			err = n.Notify(change)
+		}
+		results = append(results, TestResult{Channel: n.Name(), Err: err})
+	}
+	EndCycle()
+	if channel != "" && len(results) == 0 {
+		return nil, fmt.Errorf("unknown channel %q", channel)
+	}
+	return results, nil
+}
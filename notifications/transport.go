@@ -0,0 +1,275 @@
+package notifications
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/settings"
+	"gopkg.in/gomail.v2"
+)
+
+// TLS modes of the SMTP connection
+const (
+	// TLSImplicit opens a TLS connection right away, usually on port 465
+	TLSImplicit = "implicit"
+	// TLSStartTLS upgrades the connection with STARTTLS and fails if the server does not support it
+	TLSStartTLS = "starttls"
+	// TLSOpportunistic upgrades the connection with STARTTLS only if the server supports it
+	TLSOpportunistic = "opportunistic"
+	// TLSNone never encrypts the connection
+	TLSNone = "none"
+)
+
+// SMTP authentication mechanisms
+const (
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	AuthNone    = "none"
+)
+
+const (
+	// dialTimeout bounds the connection to the SMTP server, as gomail did
+	dialTimeout = 10 * time.Second
+	// sendTimeout bounds the handshake, each message and the final QUIT, so
+	// a server that stops answering does not block the poll cycle
+	sendTimeout = time.Minute
+)
+
+// Transport is a gomail.Sender that keeps the SMTP connection open between
+// messages. It is closed at the end of every poll cycle.
+type Transport struct {
+	Host      string
+	Port      int
+	TLSMode   string
+	TLSConfig *tls.Config
+	Auth      smtp.Auth
+	LocalName string
+
+	mutex  sync.Mutex
+	sender gomail.SendCloser
+}
+
+type smtpSender struct {
+	*smtp.Client
+	conn net.Conn
+}
+
+// NewSMTPTransport builds the transport for an SMTP server of the config file.
+// The credentials of the server take precedence over the given ones.
+func NewSMTPTransport(config settings.SMTPServer, username string, password string) (*Transport, error) {
+	if config.Username != "" {
+		username, password = config.Username, config.Password
+	}
+	t := &Transport{
+		Host:      config.Server,
+		Port:      config.Port,
+		TLSMode:   strings.ToLower(config.TLS),
+		LocalName: config.LocalName,
+		TLSConfig: &tls.Config{ServerName: config.Server, InsecureSkipVerify: config.InsecureSkipVerify},
+	}
+	if t.TLSMode == "" {
+		t.TLSMode = TLSOpportunistic
+		if t.Port == 465 {
+			t.TLSMode = TLSImplicit
+		}
+	}
+	switch t.TLSMode {
+	case TLSImplicit, TLSStartTLS, TLSOpportunistic, TLSNone:
+	default:
+		return nil, fmt.Errorf("unknown smtp.tls mode %q", config.TLS)
+	}
+
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSConfig.RootCAs = x509.NewCertPool()
+		if !t.TLSConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+	}
+
+	auth := strings.ToLower(config.Auth)
+	if auth == "" && username == "" {
+		// Without credentials, e.g. a relay that trusts the host, the
+		// default is not to authenticate
+		auth = AuthNone
+	}
+	switch auth {
+	case AuthPlain, "":
+		t.Auth = smtp.PlainAuth("", username, password, config.Server)
+	case AuthLogin:
+		t.Auth = &loginAuth{username: username, password: password}
+	case AuthCRAMMD5:
+		t.Auth = smtp.CRAMMD5Auth(username, password)
+	case AuthNone:
+	default:
+		return nil, fmt.Errorf("unknown smtp.auth mechanism %q", config.Auth)
+	}
+	if t.Auth != nil && username == "" {
+		return nil, fmt.Errorf("smtp.auth %s of %s needs a username", auth, config.Server)
+	}
+	return t, nil
+}
+
+// Send delivers a message, dialing the server if there is no open connection.
+// A failure on a reused connection is retried once on a fresh one, since the
+// server may have dropped it while idle.
+func (t *Transport) Send(from string, to []string, msg io.WriterTo) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.sender != nil {
+		if err := t.sender.Send(from, to, msg); err == nil {
+			return nil
+		}
+		t.sender.Close()
+		t.sender = nil
+	}
+
+	sender, err := t.dial()
+	if err != nil {
+		return err
+	}
+	if err = sender.Send(from, to, msg); err != nil {
+		sender.Close()
+		return err
+	}
+	t.sender = sender
+	return nil
+}
+
+// CloseCycle closes the connection opened during the poll cycle, if any
+func (t *Transport) CloseCycle() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.sender == nil {
+		return nil
+	}
+	err := t.sender.Close()
+	t.sender = nil
+	return err
+}
+
+func (t *Transport) dial() (gomail.SendCloser, error) {
+	address := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	log.LogStd(i18n.Tr("cli.smtp_connecting", address, t.TLSMode), false)
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if t.TLSMode == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, t.TLSConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+	c, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err = t.handshake(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &smtpSender{Client: c, conn: conn}, nil
+}
+
+func (t *Transport) handshake(c *smtp.Client) error {
+	if t.LocalName != "" {
+		if err := c.Hello(t.LocalName); err != nil {
+			return err
+		}
+	}
+
+	if t.TLSMode == TLSStartTLS || t.TLSMode == TLSOpportunistic {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(t.TLSConfig); err != nil {
+				return err
+			}
+		} else if t.TLSMode == TLSStartTLS {
+			return errors.New("the SMTP server does not support STARTTLS")
+		}
+	}
+
+	if t.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			return c.Auth(t.Auth)
+		}
+	}
+	return nil
+}
+
+func (s *smtpSender) Send(from string, to []string, msg io.WriterTo) error {
+	// The deadline also applies through the STARTTLS connection, which
+	// wraps this one
+	s.conn.SetDeadline(time.Now().Add(sendTimeout))
+	if err := s.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := s.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := s.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = msg.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *smtpSender) Close() error {
+	s.conn.SetDeadline(time.Now().Add(sendTimeout))
+	return s.Quit()
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which net/smtp lacks
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" {
+		return "", nil, errors.New("refusing LOGIN authentication over an unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+}
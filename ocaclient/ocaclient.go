@@ -2,6 +2,7 @@ package ocaclient
 
 import (
 	"encoding/json"
+	"regexp"
 
 	"github.com/ddliu/go-httpclient"
 	"github.com/eljuanchosf/gocafier/caching"
@@ -11,6 +12,14 @@ const (
 	ocaBaseURL = "http://www.oca.com.ar"
 )
 
+// trackingNumber is the format of OCA tracking numbers, only digits
+var trackingNumber = regexp.MustCompile(`^[0-9]{10,20}$`)
+
+// ValidNumber tells whether a string looks like an OCA tracking number
+func ValidNumber(packageNumber string) bool {
+	return trackingNumber.MatchString(packageNumber)
+}
+
 // RequestData sends a GET request to the OCA web service using
 // the packageType and packageNumber provided by the user.
 func RequestData(packageType string, packageNumber string) (response caching.OcaPackageDetail, success bool, err error) {
@@ -0,0 +1,170 @@
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/notifications"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+// Supported push server kinds
+const (
+	KindNtfy   = "ntfy"
+	KindGotify = "gotify"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+)
+
+// Notifier sends push notifications through a self-hosted ntfy or Gotify server
+type Notifier struct {
+	Kind string
+	// URL is the base URL of the server, e.g. https://ntfy.example.com
+	URL string
+	// Topic is the ntfy topic. A %s in it is replaced by the package number.
+	Topic string
+	// Topics overrides the topic of specific packages
+	Topics map[string]string
+	// Token is the ntfy access token or the Gotify application token
+	Token string
+	// ClickURL is opened when the notification is tapped. A %s in it is
+	// replaced by the package number.
+	ClickURL string
+}
+
+type gotifyMessage struct {
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+var client = &http.Client{Timeout: requestTimeout}
+
+// Name returns the channel name, which includes the server so that
+// several servers can be told apart
+func (n *Notifier) Name() string {
+	return n.Kind + ":" + n.URL
+}
+
+// Notify pushes the change, with a priority that follows the package status.
+// Exceptions are always urgent.
+func (n *Notifier) Notify(change notifications.Change) error {
+	packageStatus := status.Of(change.Current)
+	title := fmt.Sprintf("OCA %s", change.PackageNumber)
+	if movement, ok := change.Current.LastMovement(); ok {
+		title = fmt.Sprintf("%s: %s", title, movement.Description)
+	}
+	var message bytes.Buffer
+	movements := change.Movements()
+	if len(movements) == 0 {
+		// Stuck alerts have no new movements, so the last one is shown
+		if movement, ok := change.Current.LastMovement(); ok {
+			movements = []caching.DetailLog{movement}
+		}
+	}
+	for _, movement := range movements {
+		fmt.Fprintf(&message, "%s: %s\n", movement.Date, movement.Description)
+	}
+	if packageStatus == status.AtBranch {
+		if branch := notifications.BranchAddress(change.Current); branch != "" {
+			fmt.Fprintln(&message, branch)
+		}
+	}
+
+	var req *http.Request
+	var err error
+	switch n.Kind {
+	case KindNtfy:
+		req, err = n.ntfyRequest(change.PackageNumber, title, message.String(), change.Priority())
+	case KindGotify:
+		req, err = n.gotifyRequest(change.PackageNumber, title, message.String(), change.Priority())
+	default:
+		return fmt.Errorf("unknown push server kind %q", n.Kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%s server answered %s: %s", n.Kind, res.Status, strings.TrimSpace(string(body)))
+	}
+	log.LogPackage(change.PackageNumber, i18n.Tr("cli.push_sent", n.Kind, change.Priority()))
+	return nil
+}
+
+func (n *Notifier) ntfyRequest(packageNumber string, title string, message string, priority status.Priority) (*http.Request, error) {
+	topic := n.Topic
+	if override, ok := n.Topics[packageNumber]; ok {
+		topic = override
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("no ntfy topic configured for %s", packageNumber)
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(n.URL, "/")+"/"+withPackage(topic, packageNumber), strings.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	// ntfy decodes RFC 2047 headers, which keeps accented descriptions intact
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", title))
+	req.Header.Set("Priority", fmt.Sprintf("%d", priority))
+	req.Header.Set("Tags", "package")
+	if n.ClickURL != "" {
+		req.Header.Set("Click", withPackage(n.ClickURL, packageNumber))
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return req, nil
+}
+
+func (n *Notifier) gotifyRequest(packageNumber string, title string, message string, priority status.Priority) (*http.Request, error) {
+	payload := gotifyMessage{
+		Title:   title,
+		Message: message,
+		// Gotify priorities go from 0 to 10
+		Priority: int(priority)*2 - 1,
+	}
+	if n.ClickURL != "" {
+		payload.Extras = map[string]interface{}{
+			"client::notification": map[string]interface{}{
+				"click": map[string]string{"url": withPackage(n.ClickURL, packageNumber)},
+			},
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(n.URL, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", n.Token)
+	return req, nil
+}
+
+func withPackage(pattern string, packageNumber string) string {
+	if strings.Contains(pattern, "%s") {
+		return fmt.Sprintf(pattern, packageNumber)
+	}
+	return pattern
+}
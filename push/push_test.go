@@ -0,0 +1,178 @@
+package push
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/notifications"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+// request is what the local stand-in server got
+type request struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+// newServer records the requests and answers them with the given status
+func newServer(code int) (*httptest.Server, *[]request) {
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, request{path: r.URL.Path, header: r.Header, body: string(body)})
+		w.WriteHeader(code)
+		if code != http.StatusOK {
+			w.Write([]byte("topic not allowed\n"))
+		}
+	}))
+	return server, &requests
+}
+
+func fixtureChange(t *testing.T, packageNumber string) notifications.Change {
+	var current caching.OcaPackageDetail
+	fixture := `{"data":[{"type":"paquetes","log":[
+		{"date":"01/01/2016 10:00","description":"En tránsito"},
+		{"date":"02/01/2016 09:00","description":"En distribución"}]}]}`
+	if err := json.Unmarshal([]byte(fixture), &current); err != nil {
+		t.Fatal(err)
+	}
+	return notifications.Change{PackageNumber: packageNumber, Current: current, Diff: current.Data[0].Log[1:]}
+}
+
+func TestNtfy(t *testing.T) {
+	server, requests := newServer(http.StatusOK)
+	defer server.Close()
+	n := &Notifier{
+		Kind:     KindNtfy,
+		URL:      server.URL + "/",
+		Topic:    "oca-%s",
+		Topics:   map[string]string{"999999999999": "regalo"},
+		Token:    "tk_secret",
+		ClickURL: "https://www.oca.com.ar/seguimiento/%s",
+	}
+	if err := n.Notify(fixtureChange(t, "123123123123")); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(fixtureChange(t, "999999999999")); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(*requests))
+	}
+
+	r := (*requests)[0]
+	if r.path != "/oca-123123123123" {
+		t.Errorf("path = %q, want the topic with the package number", r.path)
+	}
+	if (*requests)[1].path != "/regalo" {
+		t.Errorf("path = %q, want the topic of the package", (*requests)[1].path)
+	}
+	title, err := new(mime.WordDecoder).DecodeHeader(r.header.Get("Title"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "OCA 123123123123: En distribución" {
+		t.Errorf("decoded Title = %q", title)
+	}
+	if strings.ContainsAny(r.header.Get("Title"), "ó") {
+		t.Errorf("Title %q is not Q-encoded", r.header.Get("Title"))
+	}
+	if got := r.header.Get("Priority"); got != "4" {
+		t.Errorf("Priority = %q, want 4 for a package out for delivery", got)
+	}
+	if got := r.header.Get("Click"); got != "https://www.oca.com.ar/seguimiento/123123123123" {
+		t.Errorf("Click = %q", got)
+	}
+	if got := r.header.Get("Authorization"); got != "Bearer tk_secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if r.body != "02/01/2016 09:00: En distribución\n" {
+		t.Errorf("body = %q, want the new movement only", r.body)
+	}
+}
+
+func TestNtfyWithoutTopic(t *testing.T) {
+	server, requests := newServer(http.StatusOK)
+	defer server.Close()
+	n := &Notifier{Kind: KindNtfy, URL: server.URL}
+	if err := n.Notify(fixtureChange(t, "123123123123")); err == nil {
+		t.Error("a package without topic was pushed")
+	}
+	if len(*requests) != 0 {
+		t.Errorf("got %d requests, want none", len(*requests))
+	}
+}
+
+func TestGotify(t *testing.T) {
+	server, requests := newServer(http.StatusOK)
+	defer server.Close()
+	n := &Notifier{Kind: KindGotify, URL: server.URL, Token: "AppToken", ClickURL: "https://www.oca.com.ar/%s"}
+
+	// Gotify priorities go from 0 to 10
+	want := map[status.Priority]int{
+		status.PriorityMin:     1,
+		status.PriorityLow:     3,
+		status.PriorityDefault: 5,
+		status.PriorityHigh:    7,
+		status.PriorityUrgent:  9,
+	}
+	for priority, gotify := range want {
+		*requests = nil
+		change := fixtureChange(t, "123123123123")
+		change.PriorityOverride = priority
+		if err := n.Notify(change); err != nil {
+			t.Fatal(err)
+		}
+		r := (*requests)[0]
+		if r.path != "/message" {
+			t.Errorf("path = %q, want /message", r.path)
+		}
+		if got := r.header.Get("X-Gotify-Key"); got != "AppToken" {
+			t.Errorf("X-Gotify-Key = %q", got)
+		}
+		var message struct {
+			Title    string `json:"title"`
+			Message  string `json:"message"`
+			Priority int    `json:"priority"`
+			Extras   map[string]map[string]map[string]string
+		}
+		if err := json.Unmarshal([]byte(r.body), &message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Priority != gotify {
+			t.Errorf("priority %d was pushed as %d, want %d", priority, message.Priority, gotify)
+		}
+		if message.Title != "OCA 123123123123: En distribución" || message.Message != "02/01/2016 09:00: En distribución\n" {
+			t.Errorf("message = %+v", message)
+		}
+		if url := message.Extras["client::notification"]["click"]["url"]; url != "https://www.oca.com.ar/123123123123" {
+			t.Errorf("click url = %q", url)
+		}
+	}
+}
+
+func TestServerError(t *testing.T) {
+	for _, kind := range []string{KindNtfy, KindGotify} {
+		server, _ := newServer(http.StatusForbidden)
+		n := &Notifier{Kind: kind, URL: server.URL, Topic: "oca"}
+		err := n.Notify(fixtureChange(t, "123123123123"))
+		if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "topic not allowed") {
+			t.Errorf("%s: error = %v, want the status and the body of the answer", kind, err)
+		}
+		server.Close()
+	}
+}
+
+func TestUnknownKind(t *testing.T) {
+	n := &Notifier{Kind: "pushover", URL: "http://127.0.0.1:1"}
+	if err := n.Notify(fixtureChange(t, "123123123123")); err == nil {
+		t.Error("an unknown kind was accepted")
+	}
+}
@@ -0,0 +1,176 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/calendar"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/notifications"
+	"github.com/eljuanchosf/gocafier/settings"
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+// descriptions caches the compiled description of each rule
+var descriptions = map[string]*regexp.Regexp{}
+
+// Check validates the rules against the registered notifiers and the event types
+func Check() error {
+	for i, rule := range settings.Values.Rules {
+		for _, name := range rule.Actions.Channels {
+			if !notifications.HasNotifier(name) {
+				return fmt.Errorf("rules[%s].actions.channels: unknown channel %q", rule.Label(i), name)
+			}
+		}
+		for _, event := range rule.Match.Event {
+			if !knownEvent(event) {
+				return fmt.Errorf("rules[%s].match.event: unknown event %q", rule.Label(i), event)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply evaluates the rules against a change, in order, and returns the
+// change with the actions of the matching ones applied. It is false when a
+// rule muted the change.
+func Apply(change notifications.Change, now time.Time) (notifications.Change, bool, error) {
+	if len(settings.Values.Rules) == 0 {
+		return change, true, nil
+	}
+	meta, err := caching.GetMeta(change.PackageNumber)
+	if err != nil {
+		return change, false, err
+	}
+	notify, changed := true, false
+	for i, rule := range settings.Values.Rules {
+		if !matches(rule.Match, change, tags(change.PackageNumber, meta), now) {
+			continue
+		}
+		log.LogPackage(change.PackageNumber, i18n.Tr("cli.rule_matched", rule.Label(i)))
+		actions := rule.Actions
+		if actions.Channels != nil {
+			change.Channels = actions.Channels
+		}
+		if actions.Priority > 0 {
+			change.PriorityOverride = status.Priority(actions.Priority)
+		}
+		if actions.Mute {
+			notify = false
+		}
+		if actions.Archive && !meta.Archived {
+			log.LogPackage(change.PackageNumber, i18n.Tr("cli.rule_archived"))
+			meta.Archived, changed = true, true
+		}
+		var added bool
+		meta.Tags, added = caching.AddTags(meta.Tags, actions.AddTags...)
+		changed = changed || added
+		if rule.Stop {
+			break
+		}
+	}
+	if changed {
+		err = caching.SaveMeta(change.PackageNumber, meta)
+	}
+	return change, notify, err
+}
+
+func matches(match settings.RuleMatch, change notifications.Change, packageTags []string, now time.Time) bool {
+	current := change.Current.Data[0]
+	if len(match.Status) > 0 && !contains(match.Status, string(status.Of(change.Current))) {
+		return false
+	}
+	if len(match.Event) > 0 && !contains(match.Event, string(change.Type())) {
+		return false
+	}
+	if len(match.Type) > 0 && !contains(match.Type, current.Type) {
+		return false
+	}
+	if len(match.Tags) > 0 && !containsAny(match.Tags, packageTags) {
+		return false
+	}
+	if match.TimeOfDay != nil && !match.TimeOfDay.Contains(now) {
+		return false
+	}
+	if match.SinceLastEvent > 0 || match.SinceLastEventDays > 0 {
+		last, ok := change.Current.LastMovement()
+		if !ok {
+			return false
+		}
+		t, ok := last.Time()
+		if !ok || now.Sub(t) < match.SinceLastEvent || calendar.BusinessDays(t, now) < match.SinceLastEventDays {
+			return false
+		}
+	}
+	if match.Description != "" {
+		re, ok := descriptions[match.Description]
+		if !ok {
+			// The expression was validated with the config file
+			re = regexp.MustCompile(match.Description)
+			descriptions[match.Description] = re
+		}
+		found := false
+		for _, movement := range described(change) {
+			if re.MatchString(movement.Description) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// described returns the movements whose description the rules look at: the
+// new ones, or the last one when the change has none
+func described(change notifications.Change) []caching.DetailLog {
+	movements := change.Movements()
+	if len(movements) == 0 {
+		if last, ok := change.Current.LastMovement(); ok {
+			movements = []caching.DetailLog{last}
+		}
+	}
+	return movements
+}
+
+// tags returns the tags of a package, from the config file and the rules
+func tags(packageNumber string, meta caching.PackageMeta) []string {
+	var all []string
+	if p, found := settings.FindPackage(packageNumber); found {
+		all = append(all, p.Tags...)
+	}
+	return append(all, meta.Tags...)
+}
+
+func knownEvent(name string) bool {
+	for _, event := range notifications.EventTypes {
+		if string(event) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list []string, values []string) bool {
+	for _, value := range values {
+		if contains(list, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package settings
+
+import (
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/calendar"
+)
+
+// AddressList is a list of email addresses. In the config file it can be
+// written as a single address, a comma separated string or a YAML list.
+// Each address may include a display name: "Juan <juan@example.com>"
+type AddressList []string
+
+// UnmarshalYAML accepts both a string and a list of strings
+func (a *AddressList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*a = nil
+		if single != "" {
+			addresses, err := mail.ParseAddressList(single)
+			if err != nil {
+				return fmt.Errorf("invalid address list %q: %s", single, err)
+			}
+			for _, address := range addresses {
+				*a = append(*a, address.String())
+			}
+		}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Parse returns the parsed addresses of the list
+func (a AddressList) Parse() ([]*mail.Address, error) {
+	var addresses []*mail.Address
+	for _, raw := range a {
+		address, err := mail.ParseAddress(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email address %q: %s", raw, err)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// Package represents a package to track. In the config file it can be
+// written as the bare tracking number or as a map with extra settings.
+type Package struct {
+	Number string `yaml:"number"`
+	Label  string `yaml:"label"`
+	// Recipients receive the notifications of this package in addition to email.to
+	Recipients AddressList `yaml:"recipients"`
+	// StuckDays overrides the business days without movement before a stuck alert
+	StuckDays int `yaml:"stuck_days"`
+	// SLADays overrides the business days promised for the delivery
+	SLADays int `yaml:"sla_days"`
+	// Origin is the province the package was sent from, for the SLA routes.
+	// OCA does not report it.
+	Origin string `yaml:"origin"`
+	// Tags group the packages, e.g. for the rules
+	Tags []string `yaml:"tags"`
+	// Notes and Owner describe the package for the people who get its emails
+	Notes string `yaml:"notes"`
+	Owner string `yaml:"owner"`
+	// Created and ExpectedDelivery are dates in the YYYY-MM-DD format
+	Created          string `yaml:"created"`
+	ExpectedDelivery string `yaml:"expected_delivery"`
+}
+
+// UnmarshalYAML accepts both a tracking number and a map
+func (p *Package) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var number string
+	if err := unmarshal(&number); err == nil {
+		*p = Package{Number: number}
+		return nil
+	}
+	type plain Package
+	return unmarshal((*plain)(p))
+}
+
+// FindPackage returns the settings of a package listed in the config file
+func FindPackage(packageNumber string) (Package, bool) {
+	for _, p := range Values.Packages {
+		if p.Number == packageNumber {
+			return p, true
+		}
+	}
+	return Package{}, false
+}
+
+// PackageNumbers returns the tracking numbers listed in the config file
+func PackageNumbers() []string {
+	var numbers []string
+	for _, p := range Values.Packages {
+		numbers = append(numbers, p.Number)
+	}
+	return numbers
+}
+
+func validatePackages(config Config) error {
+	for _, p := range config.Packages {
+		dates := map[string]string{"created": p.Created, "expected_delivery": p.ExpectedDelivery}
+		for key, date := range dates {
+			if _, err := time.Parse(calendar.DateLayout, date); date != "" && err != nil {
+				return fmt.Errorf("packages[%s].%s: invalid date %q, expected YYYY-MM-DD", p.Number, key, date)
+			}
+		}
+	}
+	return nil
+}
+
+func validateAddresses(config Config) error {
+	if _, err := mail.ParseAddress(config.Email.From); config.Email.From != "" && err != nil {
+		return fmt.Errorf("email.from: invalid email address %q: %s", config.Email.From, err)
+	}
+	lists := map[string]AddressList{
+		"email.to":       config.Email.To,
+		"email.cc":       config.Email.Cc,
+		"email.bcc":      config.Email.Bcc,
+		"email.reply_to": config.Email.ReplyTo,
+	}
+	for _, p := range config.Packages {
+		lists[fmt.Sprintf("packages[%s].recipients", p.Number)] = p.Recipients
+	}
+	for key, list := range lists {
+		if _, err := list.Parse(); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+	}
+	return nil
+}
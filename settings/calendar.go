@@ -0,0 +1,66 @@
+package settings
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/calendar"
+)
+
+// CalendarSettings changes the built-in Argentine holidays used to count
+// business days
+type CalendarSettings struct {
+	// Holidays are added to the built-in ones, e.g. the days declared
+	// non-working by decree
+	Holidays []HolidaySettings `yaml:"holidays"`
+	// Workdays are business days even if they are holidays, e.g. the original
+	// date of a holiday moved by decree
+	Workdays []string `yaml:"workdays"`
+	// ICal are iCalendar files whose events are added as holidays
+	ICal []string `yaml:"ical"`
+}
+
+// HolidaySettings is a holiday of the config file
+type HolidaySettings struct {
+	Date string `yaml:"date"`
+	Name string `yaml:"name"`
+}
+
+// loadCalendar validates the calendar of the config file and loads it
+func loadCalendar(config Config) error {
+	var holidays []calendar.Holiday
+	for _, h := range config.Calendar.Holidays {
+		date, err := time.Parse(calendar.DateLayout, h.Date)
+		if err != nil {
+			return fmt.Errorf("calendar.holidays: %q is not a YYYY-MM-DD date", h.Date)
+		}
+		holidays = append(holidays, calendar.Holiday{Date: date, Name: h.Name})
+	}
+	for _, path := range config.Calendar.ICal {
+		imported, err := readICal(path)
+		if err != nil {
+			return fmt.Errorf("calendar.ical: %s: %s", path, err)
+		}
+		holidays = append(holidays, imported...)
+	}
+	var workdays []time.Time
+	for _, day := range config.Calendar.Workdays {
+		date, err := time.Parse(calendar.DateLayout, day)
+		if err != nil {
+			return fmt.Errorf("calendar.workdays: %q is not a YYYY-MM-DD date", day)
+		}
+		workdays = append(workdays, date)
+	}
+	calendar.Configure(holidays, workdays)
+	return nil
+}
+
+func readICal(path string) ([]calendar.Holiday, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return calendar.ParseICal(file)
+}
@@ -0,0 +1,227 @@
+package settings
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DigestSettings configures the channels and recipients that get a
+// scheduled summary instead of a notification per change
+type DigestSettings struct {
+	// Time is when the digest is sent, as HH:MM in the configured timezone
+	Time string `yaml:"time"`
+	// Weekday makes the digest weekly. It is daily when empty.
+	Weekday string `yaml:"weekday"`
+	// Channels are the names of the notification channels in digest mode,
+	// e.g. email, slack or exec:/path/to/script
+	Channels []string `yaml:"channels"`
+	// Recipients are the email addresses in digest mode
+	Recipients AddressList `yaml:"recipients"`
+	// Schedules put more channels and recipients in digest mode, each one
+	// with its own time and weekday
+	Schedules []DigestSchedule `yaml:"schedules"`
+	// Immediate lists the statuses that are still notified right away
+	Immediate []string `yaml:"immediate"`
+	// BusinessDays moves the digests due on weekends and holidays to the
+	// next business day
+	BusinessDays bool `yaml:"business_days"`
+}
+
+// DigestSchedule is when the digests of some channels and recipients are sent
+type DigestSchedule struct {
+	// Time is when the digest is sent, as HH:MM in the configured timezone
+	Time string `yaml:"time"`
+	// Weekday makes the digest weekly. It is daily when empty.
+	Weekday string `yaml:"weekday"`
+	// Channels are the names of the notification channels with this schedule
+	Channels []string `yaml:"channels"`
+	// Recipients are the email addresses with this schedule
+	Recipients AddressList `yaml:"recipients"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Enabled tells whether any channel or recipient is in digest mode
+func (d DigestSettings) Enabled() bool {
+	if len(d.Channels) > 0 || len(d.Recipients) > 0 {
+		return true
+	}
+	for _, schedule := range d.Schedules {
+		if len(schedule.Channels) > 0 || len(schedule.Recipients) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Default returns the schedule of the channels and recipients that do not
+// have their own
+func (d DigestSettings) Default() DigestSchedule {
+	return DigestSchedule{Time: d.Time, Weekday: d.Weekday, Channels: d.Channels, Recipients: d.Recipients}
+}
+
+// AllChannels returns the names of every channel in digest mode
+func (d DigestSettings) AllChannels() []string {
+	channels := append([]string{}, d.Channels...)
+	for _, schedule := range d.Schedules {
+		for _, name := range schedule.Channels {
+			if !containsName(channels, name) {
+				channels = append(channels, name)
+			}
+		}
+	}
+	return channels
+}
+
+// ChannelSchedule returns the schedule of a channel in digest mode
+func (d DigestSettings) ChannelSchedule(name string) DigestSchedule {
+	for _, schedule := range d.Schedules {
+		if schedule.hasChannel(name) {
+			return schedule
+		}
+	}
+	return d.Default()
+}
+
+// RecipientSchedule returns the schedule of an email address that has its
+// own. The second value is false for the addresses on the default schedule
+// or on the one of the email channel.
+func (d DigestSettings) RecipientSchedule(address string) (DigestSchedule, bool) {
+	for _, schedule := range d.Schedules {
+		if schedule.hasRecipient(address) {
+			return schedule, true
+		}
+	}
+	return DigestSchedule{}, false
+}
+
+// ScheduledRecipients returns the email addresses that have their own schedule
+func (d DigestSettings) ScheduledRecipients() []string {
+	var recipients []string
+	for _, schedule := range d.Schedules {
+		addresses, _ := schedule.Recipients.Parse()
+		for _, a := range addresses {
+			recipients = append(recipients, strings.ToLower(a.Address))
+		}
+	}
+	return recipients
+}
+
+// HasChannel tells whether a notification channel is in digest mode
+func (d DigestSettings) HasChannel(name string) bool {
+	return containsName(d.AllChannels(), name)
+}
+
+// HasRecipient tells whether an email address is in digest mode
+func (d DigestSettings) HasRecipient(address string) bool {
+	if d.HasChannel("email") || d.Default().hasRecipient(address) {
+		return true
+	}
+	_, found := d.RecipientSchedule(address)
+	return found
+}
+
+// Clock returns the hour and minute of the digest. It defaults to 08:00.
+func (s DigestSchedule) Clock() (hour int, minute int, err error) {
+	if s.Time == "" {
+		return 8, 0, nil
+	}
+	t, err := time.Parse("15:04", s.Time)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%q is not a HH:MM time", s.Time)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// Day returns the weekday of a weekly digest. The second value is false
+// for daily digests.
+func (s DigestSchedule) Day() (time.Weekday, bool, error) {
+	if s.Weekday == "" {
+		return time.Sunday, false, nil
+	}
+	day, ok := weekdays[strings.ToLower(s.Weekday)]
+	if !ok {
+		return time.Sunday, false, fmt.Errorf("unknown weekday %q", s.Weekday)
+	}
+	return day, true, nil
+}
+
+func (s DigestSchedule) hasChannel(name string) bool {
+	return containsName(s.Channels, name)
+}
+
+func (s DigestSchedule) hasRecipient(address string) bool {
+	addresses, _ := s.Recipients.Parse()
+	for _, a := range addresses {
+		if strings.EqualFold(a.Address, address) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsName(names []string, name string) bool {
+	for _, item := range names {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validateDigest(config Config) error {
+	if _, _, err := config.Digest.Default().Clock(); err != nil {
+		return fmt.Errorf("digest.time: %s", err)
+	}
+	if _, _, err := config.Digest.Default().Day(); err != nil {
+		return fmt.Errorf("digest.weekday: %s", err)
+	}
+	if _, err := config.Digest.Recipients.Parse(); err != nil {
+		return fmt.Errorf("digest.recipients: %s", err)
+	}
+	// A channel or recipient with two schedules would get two digests of
+	// the same changes
+	scheduled := make(map[string]bool)
+	for _, name := range config.Digest.Channels {
+		scheduled[name] = true
+	}
+	addresses, _ := config.Digest.Recipients.Parse()
+	for _, a := range addresses {
+		scheduled[strings.ToLower(a.Address)] = true
+	}
+	for i, schedule := range config.Digest.Schedules {
+		if len(schedule.Channels) == 0 && len(schedule.Recipients) == 0 {
+			return fmt.Errorf("digest.schedules[%d]: needs channels or recipients", i)
+		}
+		if _, _, err := schedule.Clock(); err != nil {
+			return fmt.Errorf("digest.schedules[%d].time: %s", i, err)
+		}
+		if _, _, err := schedule.Day(); err != nil {
+			return fmt.Errorf("digest.schedules[%d].weekday: %s", i, err)
+		}
+		addresses, err := schedule.Recipients.Parse()
+		if err != nil {
+			return fmt.Errorf("digest.schedules[%d].recipients: %s", i, err)
+		}
+		names := append([]string{}, schedule.Channels...)
+		for _, a := range addresses {
+			names = append(names, strings.ToLower(a.Address))
+		}
+		for _, name := range names {
+			if scheduled[name] {
+				return fmt.Errorf("digest.schedules[%d]: %s already has a digest schedule", i, name)
+			}
+			scheduled[name] = true
+		}
+	}
+	return nil
+}
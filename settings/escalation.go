@@ -0,0 +1,31 @@
+package settings
+
+import (
+	"fmt"
+)
+
+// EscalationSettings configures where the exceptions, such as failed
+// deliveries or returns to sender, are escalated
+type EscalationSettings struct {
+	// Channels only get the exceptions, e.g. a ntfy server for whoever is on call
+	Channels []string `yaml:"channels"`
+	// Recipients are email addresses that only get the exceptions
+	Recipients AddressList `yaml:"recipients"`
+}
+
+// HasChannel tells whether a notification channel only gets the exceptions
+func (e EscalationSettings) HasChannel(name string) bool {
+	for _, channel := range e.Channels {
+		if channel == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validateEscalation(config Config) error {
+	if _, err := config.Escalation.Recipients.Parse(); err != nil {
+		return fmt.Errorf("escalation.recipients: %s", err)
+	}
+	return nil
+}
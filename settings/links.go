@@ -0,0 +1,57 @@
+package settings
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LinkSettings configures the mute and unsubscribe links of the emails
+type LinkSettings struct {
+	// BaseURL is the public address of the HTTP server, e.g.
+	// https://gocafier.example.com. The links are left out when empty.
+	BaseURL string `yaml:"base_url"`
+	// MuteFor is how long the mute link silences a package, e.g. 7d. It
+	// defaults to 7d.
+	MuteFor string `yaml:"mute_for"`
+}
+
+// MuteDuration returns how long the mute link silences a package
+func (l LinkSettings) MuteDuration() (time.Duration, error) {
+	if l.MuteFor == "" {
+		return 7 * 24 * time.Hour, nil
+	}
+	return ParseDuration(l.MuteFor)
+}
+
+// ParseDuration parses a duration like time.ParseDuration does, also
+// accepting days, e.g. 3d
+func ParseDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return duration, nil
+}
+
+func validateLinks(config Config) error {
+	if config.Links.BaseURL != "" {
+		parsed, err := url.Parse(config.Links.BaseURL)
+		if err != nil || !parsed.IsAbs() {
+			return fmt.Errorf("links.base_url: invalid URL %q", config.Links.BaseURL)
+		}
+	}
+	if _, err := config.Links.MuteDuration(); err != nil {
+		return fmt.Errorf("links.mute_for: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package settings
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/i18n"
+)
+
+var location *time.Location
+
+// Location returns the timezone used to show dates. It is nil when none is
+// configured, so dates keep the Argentine time given by OCA.
+func Location() *time.Location {
+	return location
+}
+
+// Locale returns the locale of the notifications and replies that are not
+// sent to an email address. It defaults to es-AR, while the console stays in
+// English.
+func Locale() string {
+	return i18n.Normalize(Values.Locale)
+}
+
+// LocaleFor returns the locale of the notifications sent to an address
+func LocaleFor(address string) string {
+	for raw, locale := range Values.Email.RecipientLocales {
+		if parsed, err := mail.ParseAddress(raw); err == nil && strings.EqualFold(parsed.Address, address) {
+			return i18n.Normalize(locale)
+		}
+	}
+	return Locale()
+}
+
+// loadLocales validates the locales of the config file and loads its timezone
+func loadLocales(config Config) error {
+	if config.Locale != "" && !i18n.IsSupported(config.Locale) {
+		return fmt.Errorf("locale: unsupported locale %q", config.Locale)
+	}
+	for address, locale := range config.Email.RecipientLocales {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("email.recipient_locales: invalid email address %q: %s", address, err)
+		}
+		if !i18n.IsSupported(locale) {
+			return fmt.Errorf("email.recipient_locales[%s]: unsupported locale %q", address, locale)
+		}
+	}
+	location = nil
+	if config.Timezone != "" {
+		loaded, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			return fmt.Errorf("timezone: %s", err)
+		}
+		location = loaded
+	}
+	return nil
+}
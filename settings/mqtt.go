@@ -0,0 +1,12 @@
+package settings
+
+import "fmt"
+
+// validateMQTT rejects the QoS levels the MQTT client does not support, so
+// that a wrong level fails at startup instead of on every publish
+func validateMQTT(config Config) error {
+	if qos := config.MQTT.QoS; qos > 1 {
+		return fmt.Errorf("mqtt.qos: QoS %d is not supported, use 0 or 1", qos)
+	}
+	return nil
+}
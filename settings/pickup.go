@@ -0,0 +1,41 @@
+package settings
+
+import (
+	"fmt"
+)
+
+// PickupSettings configures the reminders for the packages waiting at a branch
+type PickupSettings struct {
+	// HoldDays is the business days OCA keeps a package at the branch before
+	// returning it. It defaults to 5.
+	HoldDays int `yaml:"hold_days"`
+	// ReminderTime is when the daily reminders are sent, as HH:MM in the
+	// configured timezone. It defaults to 09:00.
+	ReminderTime string `yaml:"reminder_time"`
+}
+
+// Hold returns the business days a package is kept at the branch
+func (p PickupSettings) Hold() int {
+	if p.HoldDays == 0 {
+		return 5
+	}
+	return p.HoldDays
+}
+
+// ReminderMinute returns the minute of the day of the reminders
+func (p PickupSettings) ReminderMinute() (int, error) {
+	if p.ReminderTime == "" {
+		return 9 * 60, nil
+	}
+	return minuteOfDay(p.ReminderTime)
+}
+
+func validatePickup(config Config) error {
+	if config.Pickup.HoldDays < 0 {
+		return fmt.Errorf("pickup.hold_days: days must not be negative")
+	}
+	if _, err := config.Pickup.ReminderMinute(); err != nil {
+		return fmt.Errorf("pickup.reminder_time: %s", err)
+	}
+	return nil
+}
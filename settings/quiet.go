@@ -0,0 +1,112 @@
+package settings
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours holds back the non-urgent notifications of some recipients
+// or channels during a time range of the day
+type QuietHours struct {
+	// From and To are HH:MM times in the configured timezone. The range may
+	// cross midnight, e.g. from 22:00 to 08:00.
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Recipients are email addresses
+	Recipients AddressList `yaml:"recipients"`
+	// Channels are notification channel names, e.g. slack. "email" applies
+	// to every email recipient.
+	Channels []string `yaml:"channels"`
+}
+
+// RateLimit merges the changes notified too often into a single notification
+type RateLimit struct {
+	// Package is the minimum time between two notifications of a package
+	Package time.Duration `yaml:"package"`
+	// Global is the maximum number of notifications within Window
+	Global int           `yaml:"global"`
+	Window time.Duration `yaml:"window"`
+}
+
+// Active tells whether t falls within the quiet hours
+func (q QuietHours) Active(t time.Time) bool {
+	return ClockRange{From: q.From, To: q.To}.Contains(t)
+}
+
+// ClockRange is a range of the day between two HH:MM times in the
+// configured timezone. It may cross midnight, e.g. from 22:00 to 08:00.
+type ClockRange struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// Contains tells whether t falls within the range
+func (r ClockRange) Contains(t time.Time) bool {
+	from, _ := minuteOfDay(r.From)
+	to, _ := minuteOfDay(r.To)
+	if location != nil {
+		t = t.In(location)
+	}
+	now := t.Hour()*60 + t.Minute()
+	if from <= to {
+		return now >= from && now < to
+	}
+	return now >= from || now < to
+}
+
+// applies tells whether the quiet hours cover a channel or email recipient
+func (q QuietHours) applies(channel string, recipient string) bool {
+	for _, c := range q.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	if recipient == "" {
+		return false
+	}
+	addresses, _ := q.Recipients.Parse()
+	for _, a := range addresses {
+		if strings.EqualFold(a.Address, recipient) {
+			return true
+		}
+	}
+	return false
+}
+
+// Quiet tells whether a channel, or an email recipient of the email channel,
+// is within its quiet hours at t
+func Quiet(channel string, recipient string, t time.Time) bool {
+	for _, q := range Values.QuietHours {
+		if q.applies(channel, recipient) && q.Active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func minuteOfDay(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func validateQuietHours(config Config) error {
+	for i, q := range config.QuietHours {
+		if _, err := minuteOfDay(q.From); err != nil {
+			return fmt.Errorf("quiet_hours[%d].from: %s", i, err)
+		}
+		if _, err := minuteOfDay(q.To); err != nil {
+			return fmt.Errorf("quiet_hours[%d].to: %s", i, err)
+		}
+		if _, err := q.Recipients.Parse(); err != nil {
+			return fmt.Errorf("quiet_hours[%d].recipients: %s", i, err)
+		}
+	}
+	if config.RateLimit.Global > 0 && config.RateLimit.Window <= 0 {
+		return fmt.Errorf("rate_limit.window is required by rate_limit.global")
+	}
+	return nil
+}
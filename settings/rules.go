@@ -0,0 +1,97 @@
+package settings
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+// Rule changes how the changes that match its conditions are notified
+type Rule struct {
+	Name    string      `yaml:"name"`
+	Match   RuleMatch   `yaml:"match"`
+	Actions RuleActions `yaml:"actions"`
+	// Stop skips the rules after this one when it matches
+	Stop bool `yaml:"stop"`
+}
+
+// RuleMatch holds the conditions of a rule. Every condition that is set must
+// hold, and a list holds when any of its values does.
+type RuleMatch struct {
+	// Description is a regular expression for the new movements, or for the
+	// last movement when the change has none
+	Description string `yaml:"description"`
+	// Status are canonical statuses, e.g. at_branch
+	Status []string `yaml:"status"`
+	// Event are event types, e.g. stuck
+	Event []string `yaml:"event"`
+	Tags  []string `yaml:"tags"`
+	// Type are OCA package types, e.g. cartas
+	Type []string `yaml:"type"`
+	// SinceLastEvent holds when the last movement is at least this old, in
+	// wall-clock time
+	SinceLastEvent time.Duration `yaml:"since_last_event"`
+	// SinceLastEventDays holds when the last movement is at least this many
+	// business days old, as the stuck alerts count them
+	SinceLastEventDays int `yaml:"since_last_event_days"`
+	// TimeOfDay holds for the changes detected within a range of the day
+	TimeOfDay *ClockRange `yaml:"time_of_day"`
+}
+
+// RuleActions are applied to the changes that match a rule
+type RuleActions struct {
+	// Channels are the only channels notified
+	Channels []string `yaml:"channels"`
+	// Priority replaces the priority of the change, from 1 (min) to 5 (urgent)
+	Priority int `yaml:"priority"`
+	// Mute drops the notifications of the change
+	Mute bool `yaml:"mute"`
+	// Archive stops polling the package
+	Archive bool `yaml:"archive"`
+	// AddTags are added to the package
+	AddTags []string `yaml:"add_tags"`
+}
+
+// Label returns the name of the rule, or its position when it has none
+func (r Rule) Label(index int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+func validateRules(config Config) error {
+	for i, rule := range config.Rules {
+		field := fmt.Sprintf("rules[%s]", rule.Label(i))
+		if _, err := regexp.Compile(rule.Match.Description); err != nil {
+			return fmt.Errorf("%s.match.description: %s", field, err)
+		}
+		for _, name := range rule.Match.Status {
+			if _, ok := status.Parse(name); !ok {
+				return fmt.Errorf("%s.match.status: unknown status %q", field, name)
+			}
+		}
+		for _, packageType := range rule.Match.Type {
+			if !containsType(packageType) {
+				return fmt.Errorf("%s.match.type: unknown package type %q", field, packageType)
+			}
+		}
+		if r := rule.Match.TimeOfDay; r != nil {
+			if _, err := minuteOfDay(r.From); err != nil {
+				return fmt.Errorf("%s.match.time_of_day.from: %s", field, err)
+			}
+			if _, err := minuteOfDay(r.To); err != nil {
+				return fmt.Errorf("%s.match.time_of_day.to: %s", field, err)
+			}
+		}
+		if rule.Match.SinceLastEventDays < 0 {
+			return fmt.Errorf("%s.match.since_last_event_days: must not be negative", field)
+		}
+		if rule.Actions.Priority < 0 || rule.Actions.Priority > int(status.PriorityUrgent) {
+			return fmt.Errorf("%s.actions.priority: must be between 1 and 5", field)
+		}
+	}
+	return nil
+}
@@ -1,9 +1,10 @@
 package settings
 
 import (
-	"fmt"
 	"io/ioutil"
+	"time"
 
+	"github.com/eljuanchosf/gocafier/i18n"
 	"github.com/eljuanchosf/gocafier/logging"
 
 	"gopkg.in/yaml.v2"
@@ -13,18 +14,105 @@ var Values Config
 
 //Config represents the config structure for the package
 type Config struct {
-	Email struct {
+	// Locale is the language of the notifications and the console output
+	Locale string `yaml:"locale"`
+	// Timezone is used to show the dates of the movements
+	Timezone string `yaml:"timezone"`
+	Email    struct {
 		Body    string      `yaml:"body"`
-		Cc      interface{} `yaml:"cc"`
+		Cc      AddressList `yaml:"cc"`
+		Bcc     AddressList `yaml:"bcc"`
 		From    string      `yaml:"from"`
+		ReplyTo AddressList `yaml:"reply_to"`
 		Subject string      `yaml:"subject"`
-		To      string      `yaml:"to"`
+		To      AddressList `yaml:"to"`
+		// Transport is either smtp (default) or sendmail
+		Transport string `yaml:"transport"`
+		// Subjects are the subject templates of each event type
+		Subjects map[string]string `yaml:"subjects"`
+		// RecipientLocales overrides the locale for some addresses
+		RecipientLocales map[string]string `yaml:"recipient_locales"`
+		// Templates are the paths of custom templates, for every event or for
+		// each event type. The built-in ones are used when empty.
+		Templates struct {
+			HTML   string `yaml:"html"`
+			Text   string `yaml:"text"`
+			Events map[string]struct {
+				HTML string `yaml:"html"`
+				Text string `yaml:"text"`
+			} `yaml:"events"`
+			Digest struct {
+				HTML string `yaml:"html"`
+				Text string `yaml:"text"`
+			} `yaml:"digest"`
+		} `yaml:"templates"`
 	} `yaml:"email"`
-	Packages []string `yaml:"packages"`
+	DKIM struct {
+		Domain     string   `yaml:"domain"`
+		Selector   string   `yaml:"selector"`
+		PrivateKey string   `yaml:"private_key"`
+		Headers    []string `yaml:"headers"`
+	} `yaml:"dkim"`
+	Sendmail struct {
+		Path string   `yaml:"path"`
+		Args []string `yaml:"args"`
+	} `yaml:"sendmail"`
+	Digest     DigestSettings     `yaml:"digest"`
+	QuietHours []QuietHours       `yaml:"quiet_hours"`
+	Stuck      StuckSettings      `yaml:"stuck"`
+	Calendar   CalendarSettings   `yaml:"calendar"`
+	SLA        SLASettings        `yaml:"sla"`
+	Pickup     PickupSettings     `yaml:"pickup"`
+	Escalation EscalationSettings `yaml:"escalation"`
+	Rules      []Rule             `yaml:"rules"`
+	Links      LinkSettings       `yaml:"links"`
+	RateLimit  RateLimit          `yaml:"rate_limit"`
+	Packages   []Package          `yaml:"packages"`
 	SMTP     struct {
-		Port   int    `yaml:"port"`
-		Server string `yaml:"server"`
+		SMTPServer `yaml:",inline"`
+		// Relays are tried in order of priority. When set, Server is ignored.
+		Relays   []SMTPServer  `yaml:"relays"`
+		Cooldown time.Duration `yaml:"cooldown"`
 	} `yaml:"smtp"`
+	MQTT struct {
+		Broker             string `yaml:"broker"`
+		ClientID           string `yaml:"client_id"`
+		TopicPrefix        string `yaml:"topic_prefix"`
+		QoS                byte   `yaml:"qos"`
+		CAFile             string `yaml:"ca_file"`
+		InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+		Discovery          struct {
+			Enabled bool   `yaml:"enabled"`
+			Prefix  string `yaml:"prefix"`
+		} `yaml:"discovery"`
+	} `yaml:"mqtt"`
+	Push []struct {
+		Kind     string            `yaml:"kind"`
+		URL      string            `yaml:"url"`
+		Topic    string            `yaml:"topic"`
+		Topics   map[string]string `yaml:"topics"`
+		Token    string            `yaml:"token"`
+		ClickURL string            `yaml:"click_url"`
+	} `yaml:"push"`
+	Exec []struct {
+		Command string        `yaml:"command"`
+		Args    []string      `yaml:"args"`
+		Timeout time.Duration `yaml:"timeout"`
+	} `yaml:"exec"`
+}
+
+//SMTPServer represents the connection settings of an SMTP server
+type SMTPServer struct {
+	Port               int    `yaml:"port"`
+	Server             string `yaml:"server"`
+	TLS                string `yaml:"tls"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	CAFile             string `yaml:"ca_file"`
+	Auth               string `yaml:"auth"`
+	LocalName          string `yaml:"local_name"`
+	Username           string `yaml:"username"`
+	Password           string `yaml:"password"`
+	Priority           int    `yaml:"priority"`
 }
 
 //LoadConfig reads the specified config file
@@ -33,7 +121,7 @@ func LoadConfig(filename string) {
 		filename = "config.yml"
 	}
 
-	logging.LogStd(fmt.Sprintf("Loading config from %s", filename), true)
+	logging.LogStd(i18n.Tr("cli.loading_config", filename), true)
 
 	source, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -43,4 +131,62 @@ func LoadConfig(filename string) {
 	if err != nil {
 		panic(err)
 	}
+	err = validateAddresses(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = validatePackages(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = loadLocales(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = validateDigest(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = validateQuietHours(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = validateStuck(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = loadCalendar(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = validateSLA(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = validatePickup(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = validateEscalation(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = validateRules(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = validateLinks(Values)
+	if err != nil {
+		panic(err)
+	}
+	err = validateMQTT(Values)
+	if err != nil {
+		panic(err)
+	}
+}
+
+//HasPackage tells whether a package number is listed in the config file
+func HasPackage(packageNumber string) bool {
+	_, found := FindPackage(packageNumber)
+	return found
 }
@@ -0,0 +1,85 @@
+package settings
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PackageTypes are the OCA package types, in the order they are searched
+var PackageTypes = []string{"paquetes", "cartas", "dni", "partidas"}
+
+// SLASettings configures the business days promised for the deliveries
+type SLASettings struct {
+	// Types maps package types to business days, e.g. paquetes: 5
+	Types map[string]int `yaml:"types"`
+	// Routes set the business days between provinces. The first matching
+	// route is used.
+	Routes []SLARoute `yaml:"routes"`
+	// WarnBeforeDays is how many business days before the deadline the warning is
+	// sent. It defaults to 1 when unset; 0 sends it on the day of the deadline.
+	WarnBeforeDays *int `yaml:"warn_before"`
+}
+
+// SLARoute is the SLA of the shipments between two provinces. An empty
+// province matches any province.
+type SLARoute struct {
+	Origin      string `yaml:"origin"`
+	Destination string `yaml:"destination"`
+	Days        int    `yaml:"days"`
+}
+
+// SLADays returns the business days promised for the delivery of a package.
+// The package setting wins over the route, and the route over the type.
+// Zero means there is no SLA.
+func SLADays(packageNumber string, packageType string, origin string, destination string) int {
+	if p, found := FindPackage(packageNumber); found && p.SLADays > 0 {
+		return p.SLADays
+	}
+	for _, route := range Values.SLA.Routes {
+		if sameProvince(route.Origin, origin) && sameProvince(route.Destination, destination) {
+			return route.Days
+		}
+	}
+	return Values.SLA.Types[packageType]
+}
+
+// WarnBefore returns the business days before the deadline for the warning
+func (s SLASettings) WarnBefore() int {
+	if s.WarnBeforeDays == nil {
+		return 1
+	}
+	return *s.WarnBeforeDays
+}
+
+func sameProvince(configured string, actual string) bool {
+	return configured == "" || strings.EqualFold(strings.TrimSpace(configured), strings.TrimSpace(actual))
+}
+
+func validateSLA(config Config) error {
+	for packageType, days := range config.SLA.Types {
+		if !containsType(packageType) {
+			return fmt.Errorf("sla.types: unknown package type %q", packageType)
+		}
+		if days < 0 {
+			return fmt.Errorf("sla.types[%s]: days must not be negative", packageType)
+		}
+	}
+	for i, route := range config.SLA.Routes {
+		if route.Days <= 0 {
+			return fmt.Errorf("sla.routes[%d]: days must be positive", i)
+		}
+	}
+	if config.SLA.WarnBefore() < 0 {
+		return fmt.Errorf("sla.warn_before: days must not be negative")
+	}
+	return nil
+}
+
+func containsType(packageType string) bool {
+	for _, t := range PackageTypes {
+		if t == packageType {
+			return true
+		}
+	}
+	return false
+}
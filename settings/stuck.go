@@ -0,0 +1,46 @@
+package settings
+
+import (
+	"fmt"
+
+	"github.com/eljuanchosf/gocafier/status"
+)
+
+// StuckSettings configures the alerts for packages without movements
+type StuckSettings struct {
+	// Days is the number of business days without movement before the
+	// alert. Zero disables it, unless set for a status or package.
+	Days int `yaml:"days"`
+	// Statuses overrides Days for some statuses, e.g. at_branch: 2
+	Statuses map[string]int `yaml:"statuses"`
+	// Reminder is the number of business days after the alert for a single
+	// follow-up reminder. Zero disables it.
+	Reminder int `yaml:"reminder"`
+}
+
+// StuckThreshold returns the business days without movement before a stuck
+// alert for a package in a status. Zero means no alert.
+func StuckThreshold(packageNumber string, s status.Status) int {
+	if p, found := FindPackage(packageNumber); found && p.StuckDays > 0 {
+		return p.StuckDays
+	}
+	if days, ok := Values.Stuck.Statuses[string(s)]; ok {
+		return days
+	}
+	return Values.Stuck.Days
+}
+
+func validateStuck(config Config) error {
+	for name, days := range config.Stuck.Statuses {
+		if _, ok := status.Parse(name); !ok {
+			return fmt.Errorf("stuck.statuses: unknown status %q", name)
+		}
+		if days < 0 {
+			return fmt.Errorf("stuck.statuses[%s]: days must not be negative", name)
+		}
+	}
+	if config.Stuck.Days < 0 || config.Stuck.Reminder < 0 {
+		return fmt.Errorf("stuck: days must not be negative")
+	}
+	return nil
+}
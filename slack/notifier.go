@@ -0,0 +1,211 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/notifications"
+	"github.com/eljuanchosf/gocafier/settings"
+)
+
+const (
+	postMessageURL = "https://slack.com/api/chat.postMessage"
+	requestTimeout = 10 * time.Second
+)
+
+// client stops a stalled Slack API from blocking the poll cycle
+var client = &http.Client{Timeout: requestTimeout}
+
+// Notifier sends package updates to the Slack users that track the package
+type Notifier struct {
+	BotToken string
+	// APIURL is the chat.postMessage endpoint. It can point to a local server for testing.
+	APIURL string
+}
+
+// NewNotifier returns a notifier that posts with the given bot token
+func NewNotifier(botToken string) *Notifier {
+	return &Notifier{BotToken: botToken, APIURL: postMessageURL}
+}
+
+// Name returns the channel name
+func (n *Notifier) Name() string {
+	return channelName
+}
+
+// Notify sends a direct message to every Slack subscriber of the package.
+// A failing subscriber does not stop the others. The change is only retried
+// when every subscriber failed, so the ones already messaged do not get it
+// twice; the others are logged, as their errors are mostly permanent, like
+// a deactivated user.
+func (n *Notifier) Notify(change notifications.Change) error {
+	subscribers, err := caching.GetSubscribers(change.PackageNumber)
+	if err != nil {
+		return err
+	}
+	text := timeline(change.PackageNumber, change.Movements()) + alertText(change)
+	if notifications.IsException(change) {
+		text = ":warning: " + tr("email.exception") + "\n" + text
+	}
+	var failed []string
+	sent := 0
+	for _, subscriber := range subscribers {
+		if subscriber.Channel != channelName {
+			continue
+		}
+		if err = n.postMessage(subscriber.ID, text); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", subscriber.Name, err))
+			continue
+		}
+		sent++
+		log.LogPackage(change.PackageNumber, i18n.Tr("cli.slack_sent", subscriber.Name))
+	}
+	if len(failed) == 0 {
+		if sent == 0 {
+			return notifications.ErrNoRecipients
+		}
+		return nil
+	}
+	err = fmt.Errorf("slack notification failed for %s", strings.Join(failed, "; "))
+	if sent == 0 {
+		return err
+	}
+	log.LogError(fmt.Sprintf("P:%s - %s", change.PackageNumber, i18n.Tr("error.slack_not_retried")), err)
+	return nil
+}
+
+// alertText adds what the movements do not tell about some events
+func alertText(change notifications.Change) string {
+	switch change.Type() {
+	case notifications.EventStuck:
+		if movement, ok := change.Current.LastMovement(); ok {
+			return tr("headline.stuck", movement.Date) + "\n"
+		}
+	case notifications.EventReadyForPickup, notifications.EventPickupReminder:
+		var text string
+		if branch := notifications.BranchAddress(change.Current); branch != "" {
+			text += tr("email.branch") + ": " + branch + "\n"
+		}
+		if until, ok := notifications.PickupDeadline(change.Current); ok {
+			text += tr("email.pickup_until", i18n.FormatDate(settings.Locale(), until)) + "\n"
+		}
+		return text
+	case notifications.EventSLAWarning, notifications.EventSLABreach:
+		if sla, ok := notifications.PackageSLA(change.PackageNumber, change.Current, time.Now()); ok {
+			return tr("headline."+string(change.Type()), i18n.FormatDate(settings.Locale(), sla.Deadline)) + "\n"
+		}
+	}
+	return ""
+}
+
+func (n *Notifier) postMessage(channel string, text string) error {
+	payload, err := json.Marshal(map[string]string{"channel": channel, "text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", n.APIURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+n.BotToken)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid Slack response (HTTP %d): %s", res.StatusCode, err)
+	}
+	if !result.Ok {
+		return fmt.Errorf("slack API error: %s", result.Error)
+	}
+	return nil
+}
+
+// NotifyDigest sends each Slack subscriber a summary of the packages they
+// track. As with Notify, a failing subscriber does not stop the others, and
+// the digest is only retried when every subscriber failed.
+func (n *Notifier) NotifyDigest(d notifications.Digest) error {
+	recipients := make(map[string]caching.Subscriber)
+	for _, entry := range append(append([]notifications.DigestEntry{}, d.Moved...), d.Idle...) {
+		subscribers, err := caching.GetSubscribers(entry.PackageNumber)
+		if err != nil {
+			return err
+		}
+		for _, subscriber := range subscribers {
+			if subscriber.Channel == channelName {
+				recipients[subscriber.ID] = subscriber
+			}
+		}
+	}
+	var failed []string
+	sent := 0
+	for _, subscriber := range recipients {
+		tracked, err := caching.PackagesFor(subscriber)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", subscriber.Name, err))
+			continue
+		}
+		personal := d.Filter(func(packageNumber string) bool {
+			for _, code := range tracked {
+				if code == packageNumber {
+					return true
+				}
+			}
+			return false
+		})
+		if err = n.postMessage(subscriber.ID, digestText(personal)); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", subscriber.Name, err))
+			continue
+		}
+		sent++
+		log.LogStd(i18n.Tr("cli.slack_digest_sent", subscriber.Name), true)
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("slack digest failed for %s", strings.Join(failed, "; "))
+	if sent == 0 {
+		return err
+	}
+	log.LogError(i18n.Tr("error.digest_not_retried", channelName), err)
+	return nil
+}
+
+func digestText(d notifications.Digest) string {
+	var text bytes.Buffer
+	fmt.Fprintf(&text, "*%s*\n", tr("digest.title"))
+	fmt.Fprintf(&text, "*%s*\n", tr("digest.moved"))
+	for _, entry := range d.Moved {
+		fmt.Fprintf(&text, "• *%s* - %s\n", entry.PackageNumber, entry.Status().LocalizedName(settings.Locale()))
+		for _, movement := range entry.Movements {
+			fmt.Fprintf(&text, "    %s: %s\n", movement.Date, movement.Description)
+		}
+	}
+	if len(d.Moved) == 0 {
+		fmt.Fprintf(&text, "%s\n", tr("digest.none"))
+	}
+	fmt.Fprintf(&text, "*%s*\n", tr("digest.idle"))
+	for _, entry := range d.Idle {
+		last, _ := entry.Current.LastMovement()
+		fmt.Fprintf(&text, "• *%s* - %s. %s\n", entry.PackageNumber, entry.Status().LocalizedName(settings.Locale()), tr("digest.last_update", last.Date))
+	}
+	if len(d.Idle) == 0 {
+		fmt.Fprintf(&text, "%s\n", tr("digest.none"))
+	}
+	return text.String()
+}
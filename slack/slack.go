@@ -0,0 +1,187 @@
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+	log "github.com/eljuanchosf/gocafier/logging"
+	"github.com/eljuanchosf/gocafier/ocaclient"
+	"github.com/eljuanchosf/gocafier/settings"
+)
+
+const (
+	channelName = "slack"
+	// maxRequestAge is how old a signed request can be before it is
+	// considered a replay
+	maxRequestAge = 5 * time.Minute
+	// maxRequestSize is more than any slash command payload
+	maxRequestSize = 64 << 10
+)
+
+// CommandHandler serves the `/gocafier` slash command
+type CommandHandler struct {
+	SigningSecret string
+	// Now returns the current time. It can be replaced to replay recorded requests.
+	Now func() time.Time
+}
+
+type response struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// NewCommandHandler returns a handler that verifies requests with the signing secret
+func NewCommandHandler(signingSecret string) *CommandHandler {
+	return &CommandHandler{SigningSecret: signingSecret, Now: time.Now}
+}
+
+func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, "could not read request", http.StatusBadRequest)
+		return
+	}
+	if err = VerifyRequest(h.SigningSecret, r.Header, body, h.Now()); err != nil {
+		log.LogError(i18n.Tr("error.slack_rejected"), err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	subscriber := caching.Subscriber{
+		Channel: channelName,
+		ID:      form.Get("user_id"),
+		Name:    form.Get("user_name"),
+	}
+	text := runCommand(subscriber, strings.Fields(form.Get("text")))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response{ResponseType: "ephemeral", Text: text})
+}
+
+// VerifyRequest checks the Slack signature and timestamp of a request body
+func VerifyRequest(signingSecret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > maxRequestAge || age < -maxRequestAge {
+		return fmt.Errorf("timestamp %s is too far from current time", timestamp)
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func runCommand(subscriber caching.Subscriber, args []string) string {
+	if len(args) == 0 {
+		return tr("slack.usage")
+	}
+	command := strings.ToLower(args[0])
+	if command == "list" {
+		return listPackages(subscriber)
+	}
+	// The number ends up in MQTT topics and push URLs, so it must be a
+	// tracking number and nothing else
+	if len(args) != 2 || !ocaclient.ValidNumber(args[1]) {
+		return tr("slack.usage")
+	}
+	packageNumber := args[1]
+
+	switch command {
+	case "track":
+		if err := caching.Subscribe(packageNumber, subscriber); err != nil {
+			log.LogError(i18n.Tr("error.slack_subscribe"), err)
+			return tr("slack.track_failed")
+		}
+		log.LogPackage(packageNumber, i18n.Tr("cli.slack_tracked", subscriber.Name))
+		return tr("slack.tracking", packageNumber)
+	case "untrack":
+		if err := caching.Unsubscribe(packageNumber, subscriber); err != nil {
+			log.LogError(i18n.Tr("error.slack_unsubscribe"), err)
+			return tr("slack.untrack_failed")
+		}
+		log.LogPackage(packageNumber, i18n.Tr("cli.slack_untracked", subscriber.Name))
+		return tr("slack.untracked", packageNumber)
+	case "status":
+		return packageStatus(packageNumber)
+	}
+	return tr("slack.usage")
+}
+
+func listPackages(subscriber caching.Subscriber) string {
+	codes, err := caching.PackagesFor(subscriber)
+	if err != nil {
+		log.LogError(i18n.Tr("error.slack_list"), err)
+		return tr("slack.list_failed")
+	}
+	if len(codes) == 0 {
+		return tr("slack.list_empty")
+	}
+	var text bytes.Buffer
+	text.WriteString(tr("slack.list_title") + "\n")
+	for _, code := range codes {
+		last := tr("slack.no_movements")
+		if p, err := caching.GetPackage(code); err == nil && p != nil {
+			if movement, ok := p.LastMovement(); ok {
+				last = fmt.Sprintf("%s: %s", movement.Date, movement.Description)
+			}
+		}
+		fmt.Fprintf(&text, "• *%s* - %s\n", code, last)
+	}
+	return text.String()
+}
+
+func packageStatus(packageNumber string) string {
+	p, err := caching.GetPackage(packageNumber)
+	if err != nil {
+		return tr("slack.read_failed")
+	}
+	if p == nil {
+		return tr("slack.not_found", packageNumber)
+	}
+	return timeline(packageNumber, p.Data[0].Log)
+}
+
+func timeline(packageNumber string, movements []caching.DetailLog) string {
+	var text bytes.Buffer
+	fmt.Fprintf(&text, "*%s*\n", tr("slack.package", packageNumber))
+	for _, movement := range movements {
+		fmt.Fprintf(&text, "• %s: %s\n", movement.Date, movement.Description)
+	}
+	return text.String()
+}
+
+// tr returns a reply in the locale of the notifications, which can differ
+// from the one of the console
+func tr(key string, args ...interface{}) string {
+	return i18n.T(settings.Locale(), key, args...)
+}
@@ -0,0 +1,303 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/notifications"
+	"github.com/eljuanchosf/gocafier/settings"
+)
+
+// recordedSecret, recordedTimestamp, recordedBody and recordedSignature are
+// the sample request of the Slack documentation on verifying requests
+const (
+	recordedSecret    = "8f742231b10e8888abcd99yyyzzz85a5"
+	recordedTimestamp = "1531420618"
+	recordedBody      = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	recordedSignature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+)
+
+var recordedNow = time.Unix(1531420618, 0).Add(time.Minute)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "gocafier-slack")
+	if err != nil {
+		panic(err)
+	}
+	caching.CreateBucket(filepath.Join(dir, "cache.db"))
+	settings.Values.Locale = "en"
+	code := m.Run()
+	caching.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newServer serves the slash command at a local address, at the time of the
+// recorded requests
+func newServer() *httptest.Server {
+	handler := NewCommandHandler(recordedSecret)
+	handler.Now = func() time.Time { return recordedNow }
+	return httptest.NewServer(handler)
+}
+
+// post sends a slash command body with the given timestamp and signature
+func post(t *testing.T, server *httptest.Server, body string, timestamp string, signature string) (int, string) {
+	req, err := http.NewRequest("POST", server.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", signature)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode, ""
+	}
+	var reply response
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.ResponseType != "ephemeral" {
+		t.Errorf("response_type = %q, want ephemeral", reply.ResponseType)
+	}
+	return res.StatusCode, reply.Text
+}
+
+// sign returns the signature Slack sends with a body
+func sign(body string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(recordedSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// command returns the recorded body with another user and text
+func command(userID string, text string) string {
+	form, _ := url.ParseQuery(recordedBody)
+	form.Set("user_id", userID)
+	form.Set("text", text)
+	return form.Encode()
+}
+
+func TestRecordedRequest(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	status, text := post(t, server, recordedBody, recordedTimestamp, recordedSignature)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if text != tr("slack.usage") {
+		t.Errorf("an empty command got %q, want the usage", text)
+	}
+}
+
+func TestRejectedRequests(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		body      string
+		timestamp string
+		signature string
+	}{
+		{"bad signature", recordedBody, recordedTimestamp, "v0=" + strings.Repeat("0", 64)},
+		{"tampered body", strings.Replace(recordedBody, "roadrunner", "coyote", 1), recordedTimestamp, recordedSignature},
+		{"stale timestamp", recordedBody, "1531419000", sign(recordedBody, "1531419000")},
+		{"future timestamp", recordedBody, "1531429000", sign(recordedBody, "1531429000")},
+		{"missing timestamp", recordedBody, "", recordedSignature},
+	}
+	for _, test := range tests {
+		if status, _ := post(t, server, test.body, test.timestamp, test.signature); status != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", test.name, status)
+		}
+	}
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, want 405", res.StatusCode)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	run := func(text string) string {
+		body := command("U1", text)
+		status, reply := post(t, server, body, recordedTimestamp, sign(body, recordedTimestamp))
+		if status != http.StatusOK {
+			t.Fatalf("%q: status = %d, want 200", text, status)
+		}
+		return reply
+	}
+
+	if reply := run("track 111111111111"); !strings.Contains(reply, "111111111111") {
+		t.Errorf("track replied %q", reply)
+	}
+	subscribers, err := caching.GetSubscribers("111111111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subscribers) != 1 || subscribers[0] != (caching.Subscriber{Channel: channelName, ID: "U1", Name: "roadrunner"}) {
+		t.Errorf("subscribers after track = %+v", subscribers)
+	}
+
+	if reply := run("list"); !strings.Contains(reply, "111111111111") {
+		t.Errorf("list replied %q, want the tracked package", reply)
+	}
+
+	if reply := run("status 111111111111"); !strings.Contains(reply, "111111111111") {
+		t.Errorf("status of a package not found yet replied %q", reply)
+	}
+	saveFixture(t, "111111111111")
+	if reply := run("status 111111111111"); !strings.Contains(reply, "En distribución") {
+		t.Errorf("status replied %q, want the movements", reply)
+	}
+
+	run("untrack 111111111111")
+	if subscribers, _ = caching.GetSubscribers("111111111111"); len(subscribers) != 0 {
+		t.Errorf("subscribers after untrack = %+v", subscribers)
+	}
+	if reply := run("list"); strings.Contains(reply, "111111111111") {
+		t.Errorf("list replied %q after untrack", reply)
+	}
+
+	for _, text := range []string{"track", "status 1 2", "unknown 111111111111", "track gocafier/#", "track 1111+", "track 123", "untrack ../111111111111"} {
+		if reply := run(text); reply != tr("slack.usage") {
+			t.Errorf("%q replied %q, want the usage", text, reply)
+		}
+	}
+	if codes, _ := caching.PackagesFor(caching.Subscriber{Channel: channelName, ID: "U1"}); len(codes) != 0 {
+		t.Errorf("invalid numbers were tracked: %v", codes)
+	}
+}
+
+func TestNotifyPostsMessage(t *testing.T) {
+	var requests []map[string]string
+	var authorization []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("invalid chat.postMessage body: %s", err)
+		}
+		requests = append(requests, payload)
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		if payload["channel"] == "U-failing" {
+			fmt.Fprint(w, `{"ok":false,"error":"user_not_found"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer api.Close()
+
+	current := saveFixture(t, "222222222222")
+	caching.Subscribe("222222222222", caching.Subscriber{Channel: channelName, ID: "U2", Name: "ana"})
+	caching.Subscribe("222222222222", caching.Subscriber{Channel: "other", ID: "U3", Name: "juan"})
+	notifier := &Notifier{BotToken: "xoxb-test", APIURL: api.URL}
+	change := notifications.Change{PackageNumber: "222222222222", Current: current, Diff: current.Data[0].Log[1:]}
+	if err := notifier.Notify(change); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("got %d messages, want 1 for the Slack subscriber only", len(requests))
+	}
+	if requests[0]["channel"] != "U2" {
+		t.Errorf("channel = %q, want U2", requests[0]["channel"])
+	}
+	text := requests[0]["text"]
+	if !strings.Contains(text, "222222222222") || !strings.Contains(text, "En distribución") || strings.Contains(text, "En tránsito") {
+		t.Errorf("text = %q, want the package and its new movement only", text)
+	}
+	if authorization[0] != "Bearer xoxb-test" {
+		t.Errorf("Authorization = %q", authorization[0])
+	}
+
+	// A subscriber that fails does not make the others get the change twice
+	caching.Subscribe("222222222222", caching.Subscriber{Channel: channelName, ID: "U-failing", Name: "gone"})
+	requests = nil
+	if err := notifier.Notify(change); err != nil {
+		t.Errorf("a partial failure returned %s, want no retry", err)
+	}
+	if len(requests) != 2 {
+		t.Errorf("got %d messages, want one per subscriber", len(requests))
+	}
+	caching.Unsubscribe("222222222222", caching.Subscriber{Channel: channelName, ID: "U2"})
+	if err := notifier.Notify(change); err == nil {
+		t.Error("every subscriber failed and Notify returned no error")
+	}
+
+	// Nobody to message is not a failure, but it is told apart from a delivery
+	saveFixture(t, "333333333333")
+	change.PackageNumber = "333333333333"
+	if err := notifier.Notify(change); err != notifications.ErrNoRecipients {
+		t.Errorf("a package without subscribers returned %v, want ErrNoRecipients", err)
+	}
+}
+
+func TestNotifyDigestPartialFailure(t *testing.T) {
+	var channels []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		channels = append(channels, payload["channel"])
+		if payload["channel"] == "U-gone" {
+			fmt.Fprint(w, `{"ok":false,"error":"user_not_found"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer api.Close()
+
+	current := saveFixture(t, "444444444444")
+	caching.Subscribe("444444444444", caching.Subscriber{Channel: channelName, ID: "U-gone", Name: "gone"})
+	caching.Subscribe("444444444444", caching.Subscriber{Channel: channelName, ID: "U4", Name: "ana"})
+	notifier := &Notifier{BotToken: "xoxb-test", APIURL: api.URL}
+	d := notifications.Digest{Idle: []notifications.DigestEntry{{PackageNumber: "444444444444", Current: current}}}
+	if err := notifier.NotifyDigest(d); err != nil {
+		t.Errorf("a partial failure returned %s, want no retry", err)
+	}
+	if len(channels) != 2 {
+		t.Errorf("messaged %v, want every subscriber after a failure", channels)
+	}
+
+	caching.Unsubscribe("444444444444", caching.Subscriber{Channel: channelName, ID: "U4"})
+	if err := notifier.NotifyDigest(d); err == nil || !strings.Contains(err.Error(), "gone") || strings.Contains(err.Error(), "ana") {
+		t.Errorf("every subscriber failed and NotifyDigest returned %v, want the failing one only", err)
+	}
+}
+
+// saveFixture caches a package with two movements
+func saveFixture(t *testing.T, packageNumber string) caching.OcaPackageDetail {
+	var current caching.OcaPackageDetail
+	fixture := fmt.Sprintf(`{"data":[{"type":"paquetes","code":%q,"log":[
+		{"date":"01/01/2016 10:00","description":"En tránsito"},
+		{"date":"02/01/2016 09:00","description":"En distribución"}]}]}`, packageNumber)
+	if err := json.Unmarshal([]byte(fixture), &current); err != nil {
+		t.Fatal(err)
+	}
+	if err := current.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return current
+}
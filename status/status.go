@@ -0,0 +1,125 @@
+package status
+
+import (
+	"strings"
+
+	"github.com/eljuanchosf/gocafier/caching"
+	"github.com/eljuanchosf/gocafier/i18n"
+)
+
+// Status is the canonical state of a package, independent of the wording
+// OCA uses in its movement descriptions
+type Status string
+
+// Canonical statuses
+const (
+	Unknown        Status = "unknown"
+	Admitted       Status = "admitted"
+	InTransit      Status = "in_transit"
+	AtBranch       Status = "at_branch"
+	OutForDelivery Status = "out_for_delivery"
+	Delivered      Status = "delivered"
+	DeliveryFailed Status = "delivery_failed"
+	Returned       Status = "returned"
+)
+
+// Statuses lists every canonical status
+var Statuses = []Status{Unknown, Admitted, InTransit, AtBranch, OutForDelivery, Delivered, DeliveryFailed, Returned}
+
+// Parse returns the status with the given identifier, e.g. "out_for_delivery"
+func Parse(name string) (Status, bool) {
+	for _, s := range Statuses {
+		if string(s) == name {
+			return s, true
+		}
+	}
+	return Unknown, false
+}
+
+// Name returns the human readable name of the status, in the configured locale
+func (s Status) Name() string {
+	return s.LocalizedName(i18n.Locale())
+}
+
+// LocalizedName returns the human readable name of the status in a locale
+func (s Status) LocalizedName(locale string) string {
+	key := "status." + string(s)
+	if name := i18n.T(locale, key); name != key {
+		return name
+	}
+	return string(s)
+}
+
+type rule struct {
+	status   Status
+	keywords []string
+}
+
+// rules are evaluated in order, so the more specific ones go first
+var rules = []rule{
+	{Returned, []string{"devuelto", "devolucion", "retorno al remitente"}},
+	{DeliveryFailed, []string{"sin exito", "no entregad", "no se pudo entregar", "rechazad", "domicilio inexistente", "domicilio incorrecto", "domicilio incompleto", "direccion incorrecta", "direccion inexistente", "direccion incompleta", "datos incompletos", "se mudo", "ausente", "siniestr"}},
+	{Delivered, []string{"entregad"}},
+	{OutForDelivery, []string{"en distribucion", "salio a distribucion", "en proceso de entrega", "en reparto"}},
+	{AtBranch, []string{"para retirar", "disponible para retiro", "en sucursal"}},
+	{InTransit, []string{"transito", "en viaje", "en proceso de envio", "arribo", "en centro de distribucion", "en planta"}},
+	{Admitted, []string{"admitid", "ingresad", "recibid", "imposicion"}},
+}
+
+var accents = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n")
+
+// Classify maps an OCA movement description to its canonical status
+func Classify(description string) Status {
+	normalized := accents.Replace(strings.ToLower(strings.TrimSpace(description)))
+	for _, r := range rules {
+		for _, keyword := range r.keywords {
+			if strings.Contains(normalized, keyword) {
+				return r.status
+			}
+		}
+	}
+	return Unknown
+}
+
+// Of returns the canonical status of a package, based on its last movement
+func Of(p caching.OcaPackageDetail) Status {
+	movement, ok := p.LastMovement()
+	if !ok {
+		return Unknown
+	}
+	return Classify(movement.Description)
+}
+
+// IsFinal tells whether no further movements are expected in this status
+func (s Status) IsFinal() bool {
+	return s == Delivered || s == Returned
+}
+
+// IsException tells whether the status is a problem that may need someone
+// to act, such as a failed delivery or a return to sender
+func (s Status) IsException() bool {
+	return s == DeliveryFailed || s == Returned
+}
+
+// Priority is the urgency of a notification, from 1 (min) to 5 (urgent)
+type Priority int
+
+// Priority levels
+const (
+	PriorityMin     Priority = 1
+	PriorityLow     Priority = 2
+	PriorityDefault Priority = 3
+	PriorityHigh    Priority = 4
+	PriorityUrgent  Priority = 5
+)
+
+// Priority returns how urgent a notification about this status is
+func (s Status) Priority() Priority {
+	switch s {
+	case DeliveryFailed, Returned:
+		return PriorityUrgent
+	case OutForDelivery, AtBranch, Delivered:
+		return PriorityHigh
+	}
+	return PriorityDefault
+}